@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	ovs "github.com/syseleven/ovs_exporter/pkg/ovs_exporter"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/config"
 	"github.com/prometheus/exporter-toolkit/web"
 	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
 func main() {
@@ -23,7 +29,10 @@ func main() {
 	var systemRunDir = kingpin.Flag("system.run.dir", "OVS default run directory.").Default("/var/run/openvswitch").String()
 	var systemRunDirOvn = kingpin.Flag("system.run.dir.ovn", "OVN default run directory.").Default("/var/run/ovn").String()
 	var databaseVswitchName = kingpin.Flag("database.vswitch.name", "The name of OVS db.").Default("Open_vSwitch").String()
-	var databaseVswitchSocketRemote = kingpin.Flag("database.vswitch.socket.remote", "JSON-RPC unix socket to OVS db.").Default("unix:/var/run/openvswitch/db.sock").String()
+	var databaseVswitchSocketRemote = kingpin.Flag("database.vswitch.socket.remote", "JSON-RPC socket to OVS db, e.g. unix:/var/run/openvswitch/db.sock or ssl:192.0.2.1:6640.").Default("unix:/var/run/openvswitch/db.sock").String()
+	var databaseVswitchSslPrivateKey = kingpin.Flag("database.vswitch.ssl.private-key", "The PEM file of the private key for ssl: remotes of OVS db, like ovsdb-client -p.").Default("").String()
+	var databaseVswitchSslCertificate = kingpin.Flag("database.vswitch.ssl.certificate", "The PEM file of the client certificate for ssl: remotes of OVS db, like ovsdb-client -c.").Default("").String()
+	var databaseVswitchSslCACert = kingpin.Flag("database.vswitch.ssl.ca-cert", "The PEM file of the CA certificates verifying ssl: remotes of OVS db, like ovsdb-client -C.").Default("").String()
 	var databaseVswitchFileDataPath = kingpin.Flag("database.vswitch.file.data.path", "OVS db file.").Default("/etc/openvswitch/conf.db").String()
 	var databaseVswitchFileLogPath = kingpin.Flag("database.vswitch.file.log.path", "OVS db log file.").Default("/var/log/openvswitch/ovsdb-server.log").String()
 	var databaseVswitchFilePidPath = kingpin.Flag("database.vswitch.file.pid.path", "OVS db process id file.").Default("/var/run/openvswitch/ovsdb-server.pid").String()
@@ -33,8 +42,52 @@ func main() {
 	var serviceOvnControllerFileLogPath = kingpin.Flag("service.ovncontroller.file.log.path", "OVN controller daemon log file.").Default("/var/log/ovn/ovn-controller.log").String()
 	var serviceOvnControllerFilePidPath = kingpin.Flag("service.ovncontroller.file.pid.path", "OVN controller daemon process id file.").Default("/var/run/ovn/ovn-controller.pid").String()
 	var collectProcessRelatedMetrics = kingpin.Flag("collectProcessRelatedMetrics", "collect process-related metrics").Default("true").Bool()
+	var collectDatapathFlows = kingpin.Flag("collector.dp-flows", "Collect a breakdown of datapath flows from dpctl/dump-flows.").Default("false").Bool()
+	var datapathFlowsLimit = kingpin.Flag("collector.dp-flows.limit", "The maximum number of flows per datapath to break down. Datapaths with more flows are skipped.").Default("10000").Int()
+	var collectHwOffload = kingpin.Flag("collector.hw-offload", "Collect hardware offload configuration, offloaded datapath flows and offload statistics.").Default("false").Bool()
+	var hwOffloadFlowsLimit = kingpin.Flag("collector.hw-offload.limit", "The maximum number of flows per datapath to count by offload type, when hardware offload is enabled. Datapaths with more flows are not counted, unless --collector.dp-flows dumped them already.").Default("10000").Int()
+	var coverageInclude = kingpin.Flag("collector.coverage.include", "Regular expression of coverage events to export. May be repeated.").Strings()
+	var coverageExclude = kingpin.Flag("collector.coverage.exclude", "Regular expression of coverage events not to export. May be repeated.").Strings()
+	var coverageAverages = kingpin.Flag("collector.coverage.averages", "Export the 5s, 5m and 1h averages of coverage events in ovs_coverage_avg.").Default("true").Bool()
+	var collectProcessResources = kingpin.Flag("collector.process-resources", "Collect CPU, memory, file descriptor, thread and context switch metrics of OVS daemons from procfs. Requires collectProcessRelatedMetrics.").Default("false").Bool()
+	var collectVswitchdThreads = kingpin.Flag("collector.vswitchd-threads", "Collect per-thread CPU usage of ovs-vswitchd handler, revalidator and PMD threads from procfs. Requires collectProcessRelatedMetrics.").Default("false").Bool()
+	var procPath = kingpin.Flag("system.proc.dir", "procfs mountpoint.").Default("/proc").String()
+	var logPatternsConfig = kingpin.Flag("log.patterns.config", "Path to a YAML file with named regular expressions to count in OVS logs.").Default("").String()
+	var logSource = kingpin.Flag("log.source", "Where to read OVS logs from: file or journald.").Default("file").Enum("file", "journald")
+	var logJournalDirectory = kingpin.Flag("log.journal.directory", "Directory with the journal files to read when log.source is journald. Defaults to the system journal.").Default("").String()
+	var databaseVswitchJournalUnit = kingpin.Flag("database.vswitch.journal.unit", "OVS db systemd unit.").Default("ovsdb-server.service").String()
+	var serviceVswitchdJournalUnit = kingpin.Flag("service.vswitchd.journal.unit", "OVS vswitchd daemon systemd unit.").Default("ovs-vswitchd.service").String()
+	var serviceOvnControllerJournalUnit = kingpin.Flag("service.ovncontroller.journal.unit", "OVN controller daemon systemd unit.").Default("ovn-controller.service").String()
+	var readyzMaxMissedPolls = kingpin.Flag("web.readyz.max-missed-polls", "The number of poll intervals after which /readyz fails when no poll reached OVSDB.").Default("3").Int()
+	var pushGatewayURL = kingpin.Flag("push.gateway.url", "URL of a Pushgateway to push metrics to.").Default("").String()
+	var pushRemoteWriteURL = kingpin.Flag("push.remote-write.url", "URL of a Prometheus remote-write endpoint to push metrics to.").Default("").String()
+	var pushJob = kingpin.Flag("push.job", "The job label of pushed metrics.").Default("ovs").String()
+	var pushInstance = kingpin.Flag("push.instance", "The instance label of pushed metrics. Defaults to the hostname.").Default("").String()
+	var pushInterval = kingpin.Flag("push.interval", "The interval between pushes.").Default("30s").Duration()
+	var pushRetries = kingpin.Flag("push.retries", "The number of times a failed push is retried.").Default("3").Int()
+	var pushRetryBackoff = kingpin.Flag("push.retry-backoff", "The time to wait before the first retry of a failed push. It doubles with each retry.").Default("1s").Duration()
+	var pushBasicAuthUsername = kingpin.Flag("push.basic-auth.username", "The username for basic authentication to push targets.").Default("").String()
+	var pushBasicAuthPasswordFile = kingpin.Flag("push.basic-auth.password-file", "The file with the password for basic authentication to push targets.").Default("").String()
+	var pushTLSCAFile = kingpin.Flag("push.tls.ca-file", "The CA certificate to verify push targets.").Default("").String()
+	var pushTLSCertFile = kingpin.Flag("push.tls.cert-file", "The client certificate for push targets.").Default("").String()
+	var pushTLSKeyFile = kingpin.Flag("push.tls.key-file", "The client key for push targets.").Default("").String()
+	var pushTLSInsecureSkipVerify = kingpin.Flag("push.tls.insecure-skip-verify", "Disable verification of the certificates of push targets.").Default("false").Bool()
+	var otlpEndpoint = kingpin.Flag("otlp.endpoint", "URL of an OTLP receiver to export metrics to, e.g. http://localhost:4318.").Default("").String()
+	var otlpProtocol = kingpin.Flag("otlp.protocol", "The OTLP protocol: grpc or http/protobuf.").Default("http/protobuf").Enum("grpc", "http/protobuf")
+	var otlpInterval = kingpin.Flag("otlp.interval", "The interval between OTLP exports.").Default("60s").Duration()
+	var otlpTimeout = kingpin.Flag("otlp.timeout", "The timeout of an OTLP export.").Default("10s").Duration()
+	var otlpHeaders = kingpin.Flag("otlp.header", "A header sent with OTLP exports, e.g. Authorization=Bearer <token>. May be repeated.").StringMap()
+	var debugRecordDir = kingpin.Flag("debug.record-dir", "Directory to save the raw responses of OVSDB and the ovs-appctl outputs received by the exporter to.").Default("").String()
+	var debugReplayDir = kingpin.Flag("debug.replay-dir", "Directory with responses saved by debug.record-dir to answer the requests of the exporter from instead of OVS. The process resource, ovs-vswitchd thread and log collectors are disabled in replay mode, because /proc and the logs are not recorded.").Default("").String()
+	var enablePprof = kingpin.Flag("web.enable-pprof", "Serve the profiles of the Go runtime under /debug/pprof/.").Default("false").Bool()
+	var debugListenAddress = kingpin.Flag("debug.listen-address", "Address to serve /debug/pprof/ on instead of the web listener, e.g. localhost:9476. Requires web.enable-pprof.").Default("").String()
 	var toolkitFlags = webflag.AddFlags(kingpin.CommandLine, ":9475")
-	kingpin.Parse()
+	kingpin.Command("serve", "Serve metrics over HTTP.").Default()
+	var collectCmd = kingpin.Command("collect", "Poll OVS once, write the metrics to a file in the text exposition format, and exit.")
+	var collectOutput = collectCmd.Flag("output", "The file to write, e.g. in the textfile collector directory of node_exporter.").Required().String()
+	var topologyCmd = kingpin.Command("topology", "Print the bridges, ports and interfaces of OVS and exit.")
+	var topologyFormat = topologyCmd.Flag("format", "The output format: json, dot or mermaid.").Default("dot").Enum(ovs.TopologyFormats...)
+	command := kingpin.Parse()
 
 	if *isShowVersion {
 		fmt.Fprintf(os.Stdout, "%s %s", ovs.GetExporterName(), ovs.GetVersion())
@@ -45,7 +98,12 @@ func main() {
 		}
 		os.Exit(0)
 	}
-	logger, error := ovs.NewLogger(*logLevel)
+	// The topology command prints to stdout, so it logs to stderr.
+	logOutput := os.Stdout
+	if command == topologyCmd.FullCommand() {
+		logOutput = os.Stderr
+	}
+	logger, error := ovs.NewLoggerWithWriter(*logLevel, logOutput)
 	if error != nil {
 		panic(error)
 	}
@@ -57,54 +115,237 @@ func main() {
 			  "build_context", ovs.GetVersionBuildContext(),
 	)
 
-	opts := ovs.Options{
-		Timeout:                      *pollTimeout,
-		Logger:                       *slog.Default(),
-		CollectProcessRelatedMetrics: *collectProcessRelatedMetrics,
+	if *debugRecordDir != "" && *debugReplayDir != "" {
+		slog.Error("debug.record-dir and debug.replay-dir are mutually exclusive")
+		os.Exit(1)
 	}
 
-	exporter := ovs.NewExporter(opts)
+	if *logSource == "journald" && !ovs.JournaldSupported {
+		slog.Error("log.source journald requires a build with cgo and the journald build tag")
+		os.Exit(1)
+	}
+
+	coverageFilter, err := ovs.NewEventFilter(*coverageInclude, *coverageExclude)
+	if err != nil {
+		slog.Error("invalid coverage event filter", "error", err.Error())
+		os.Exit(1)
+	}
 
-	exporter.Client.System.RunDir = *systemRunDir
-	exporter.Client.System.RunDirOvn = *systemRunDirOvn
+	var logPatternRules []*ovs.LogPatternRule
+	if *logPatternsConfig != "" {
+		logPatternRules, err = ovs.LoadLogPatternRules(*logPatternsConfig)
+		if err != nil {
+			slog.Error("invalid log pattern rules", "error", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	clientConfig := ovs.ClientConfig{
+		RunDir:               *systemRunDir,
+		RunDirOvn:            *systemRunDirOvn,
+		DatabaseName:         *databaseVswitchName,
+		DatabaseRemote:       *databaseVswitchSocketRemote,
+		PrivateKeyFile:       *databaseVswitchSslPrivateKey,
+		CertificateFile:      *databaseVswitchSslCertificate,
+		CACertFile:           *databaseVswitchSslCACert,
+		DatabaseFile:         *databaseVswitchFileDataPath,
+		DatabaseLogFile:      *databaseVswitchFileLogPath,
+		DatabasePidFile:      *databaseVswitchFilePidPath,
+		SystemIDFile:         *databaseVswitchFileSystemIDPath,
+		VswitchdLogFile:      *serviceVswitchdFileLogPath,
+		VswitchdPidFile:      *serviceVswitchdFilePidPath,
+		OvnControllerLogFile: *serviceOvnControllerFileLogPath,
+		OvnControllerPidFile: *serviceOvnControllerFilePidPath,
+	}
+	options := []ovs.Option{
+		ovs.WithClientConfig(clientConfig),
+		ovs.WithTimeout(*pollTimeout),
+		ovs.WithLogger(*slog.Default()),
+		ovs.WithProcessMetrics(*collectProcessRelatedMetrics),
+		ovs.WithCoverageFilter(coverageFilter),
+		ovs.WithProcPath(*procPath),
+		ovs.WithLogPatternRules(logPatternRules),
+		ovs.WithRecordDir(*debugRecordDir),
+		ovs.WithReplayDir(*debugReplayDir),
+	}
+	if *collectDatapathFlows {
+		options = append(options, ovs.WithDatapathFlows(*datapathFlowsLimit))
+	}
+	if *collectHwOffload {
+		options = append(options, ovs.WithHwOffload(*hwOffloadFlowsLimit))
+	}
+	if !*coverageAverages {
+		options = append(options, ovs.WithoutCoverageAverages())
+	}
+	if *collectProcessResources {
+		options = append(options, ovs.WithProcessResources())
+	}
+	if *collectVswitchdThreads {
+		options = append(options, ovs.WithVswitchdThreads())
+	}
+	if *logSource == "journald" {
+		options = append(options, ovs.WithJournal(*logJournalDirectory, map[string]string{
+			"ovsdb-server":   *databaseVswitchJournalUnit,
+			"ovs-vswitchd":   *serviceVswitchdJournalUnit,
+			"ovn-controller": *serviceOvnControllerJournalUnit,
+		}))
+	}
 
-	exporter.Client.Database.Vswitch.Name = *databaseVswitchName
-	exporter.Client.Database.Vswitch.Socket.Remote = *databaseVswitchSocketRemote
-	exporter.Client.Database.Vswitch.File.Data.Path = *databaseVswitchFileDataPath
-	exporter.Client.Database.Vswitch.File.Log.Path = *databaseVswitchFileLogPath
-	exporter.Client.Database.Vswitch.File.Pid.Path = *databaseVswitchFilePidPath
-	exporter.Client.Database.Vswitch.File.SystemID.Path = *databaseVswitchFileSystemIDPath
+	exporter := ovs.NewExporter(options...)
 
-	exporter.Client.Service.Vswitchd.File.Log.Path = *serviceVswitchdFileLogPath
-	exporter.Client.Service.Vswitchd.File.Pid.Path = *serviceVswitchdFilePidPath
+	if command == topologyCmd.FullCommand() {
+		if err := exporter.Connect(); err != nil {
+			slog.Error("failed to init properly", "error", err.Error())
+			os.Exit(1)
+		}
+		topology, err := exporter.GetTopology()
+		if err != nil {
+			slog.Error("failed getting topology", "error", err.Error())
+			os.Exit(1)
+		}
+		output, err := ovs.RenderTopology(topology, *topologyFormat)
+		if err != nil {
+			slog.Error("failed rendering topology", "error", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprint(os.Stdout, output)
+		exporter.Close()
+		os.Exit(0)
+	}
+
+	if command == collectCmd.FullCommand() {
+		exitCode := 0
+		if err := exporter.Connect(); err != nil {
+			slog.Error("failed to init properly", "error", err.Error())
+			exitCode = 1
+		}
+		if err := exporter.WriteTextfile(*collectOutput); err != nil {
+			slog.Error("failed writing metrics", "output", *collectOutput, "error", err.Error())
+			exitCode = 1
+		}
+		exporter.Close()
+		os.Exit(exitCode)
+	}
 
-	exporter.Client.Service.OvnController.File.Log.Path = *serviceOvnControllerFileLogPath
-	exporter.Client.Service.OvnController.File.Pid.Path = *serviceOvnControllerFilePidPath
 	if err := exporter.Connect(); err != nil {
 		slog.Error("failed to init properly", "error", err.Error(),)
 		os.Exit(1)
 	}
 
-	slog.Info("ovs_system_id", "ovs_system_id", exporter.Client.System.ID)
+	slog.Info("ovs_system_id", "ovs_system_id", exporter.SystemInfo().ID)
 
 	exporter.SetPollInterval(int64(*pollInterval))
-	prometheus.MustRegister(exporter)
-
-	http.Handle(*metricsPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-             <head><title>OVS Exporter</title></head>
-             <body>
-             <h1>OVS Exporter</h1>
-             <p><a href='` + *metricsPath + `'>Metrics</a></p>
-             </body>
-             </html>`))
-	})
-
-	server := &http.Server{}
-	if err := web.ListenAndServe(server, toolkitFlags, slog.Default()); err != nil {
+	serverOptions := []ovs.ServerOption{
+		ovs.WithMetricsPath(*metricsPath),
+		ovs.WithReadyzMaxMissedPolls(*readyzMaxMissedPolls),
+	}
+	if *enablePprof && *debugListenAddress == "" {
+		serverOptions = append(serverOptions, ovs.WithPprof())
+	}
+	srv, err := ovs.NewServer(exporter, serverOptions...)
+	if err != nil {
+		slog.Error("failed registering metrics", "error", err.Error())
+		os.Exit(1)
+	}
+
+	if *debugListenAddress != "" {
+		if !*enablePprof {
+			slog.Warn("ignoring debug.listen-address, because web.enable-pprof is not set")
+		} else {
+			debugServer := &http.Server{
+				Addr:    *debugListenAddress,
+				Handler: ovs.NewPprofHandler(),
+			}
+			go func() {
+				slog.Info("serving pprof", "address", *debugListenAddress)
+				if err := debugServer.ListenAndServe(); err != nil {
+					slog.Error("debug listener failed", "error", err.Error())
+					os.Exit(1)
+				}
+			}()
+		}
+	}
+
+	exportRegistry := prometheus.NewRegistry()
+	exportRegistry.MustRegister(exporter)
+
+	if *pushGatewayURL != "" || *pushRemoteWriteURL != "" {
+		instance := *pushInstance
+		if instance == "" {
+			instance, _ = os.Hostname()
+		}
+		pushConfig := ovs.PushConfig{
+			GatewayURL:     *pushGatewayURL,
+			RemoteWriteURL: *pushRemoteWriteURL,
+			Job:            *pushJob,
+			Instance:       instance,
+			Interval:       *pushInterval,
+			Retries:        *pushRetries,
+			RetryBackoff:   *pushRetryBackoff,
+			HTTPClientConfig: config.HTTPClientConfig{
+				TLSConfig: config.TLSConfig{
+					CAFile:             *pushTLSCAFile,
+					CertFile:           *pushTLSCertFile,
+					KeyFile:            *pushTLSKeyFile,
+					InsecureSkipVerify: *pushTLSInsecureSkipVerify,
+				},
+			},
+		}
+		if *pushBasicAuthUsername != "" {
+			pushConfig.HTTPClientConfig.BasicAuth = &config.BasicAuth{
+				Username:     *pushBasicAuthUsername,
+				PasswordFile: *pushBasicAuthPasswordFile,
+			}
+		}
+		pusher, err := ovs.NewPusher(pushConfig, exportRegistry, *slog.Default())
+		if err != nil {
+			slog.Error("invalid push configuration", "error", err.Error())
+			os.Exit(1)
+		}
+		go pusher.Run(context.Background())
+	}
+
+	var otlpProvider *sdkmetric.MeterProvider
+	if *otlpEndpoint != "" {
+		otlpConfig := ovs.OTLPConfig{
+			Endpoint: *otlpEndpoint,
+			Protocol: *otlpProtocol,
+			Headers:  *otlpHeaders,
+			Interval: *otlpInterval,
+			Timeout:  *otlpTimeout,
+		}
+		otlpProvider, err = exporter.NewOTLPMeterProvider(context.Background(), otlpConfig, exportRegistry)
+		if err != nil {
+			slog.Error("invalid OTLP configuration", "error", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	server := &http.Server{Handler: srv}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-stop
+		slog.Info("shutting down", "signal", sig.String())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	exitCode := 0
+	if err := web.ListenAndServe(server, toolkitFlags, slog.Default()); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("listener failed", "error", err.Error(),
 		)
-		os.Exit(1)
+		exitCode = 1
+	}
+	// Shutting down the meter provider exports the metrics one last time.
+	if otlpProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), *otlpTimeout)
+		if err := otlpProvider.Shutdown(ctx); err != nil {
+			slog.Error("failed shutting down the OTLP export", "error", err.Error())
+		}
+		cancel()
 	}
+	exporter.Close()
+	os.Exit(exitCode)
 }
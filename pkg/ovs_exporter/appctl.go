@@ -0,0 +1,135 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type appctlRequest struct {
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+	ID     int      `json:"id"`
+}
+
+type appctlResponse struct {
+	Result *string     `json:"result"`
+	Error  interface{} `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+// appctlError is the error of a command the daemon refused, e.g. because
+// the command is not supported for the given arguments.
+type appctlError struct {
+	msg string
+}
+
+func (e *appctlError) Error() string {
+	return e.msg
+}
+
+// appctl sends a command to the control socket of an OVS daemon and returns
+// its reply, i.e. it does what `ovs-appctl -t <sock> <cmd> <args>` does. The
+// socket is either a path or a path prefixed with "unix:".
+func appctl(sock string, timeout int, cmd string, args ...string) (string, error) {
+	if timeout < 1 {
+		timeout = 2
+	}
+	path := strings.TrimPrefix(sock, "unix:")
+	conn, err := net.DialTimeout("unix", path, time.Duration(timeout)*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed '%s' via %s: %s", cmd, sock, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+
+	if args == nil {
+		args = []string{}
+	}
+	req := appctlRequest{
+		Method: cmd,
+		Params: args,
+		ID:     0,
+	}
+	if err := json.NewEncoder(conn).Encode(&req); err != nil {
+		return "", fmt.Errorf("the '%s' command failed via %s: %s", cmd, sock, err)
+	}
+	var resp appctlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", fmt.Errorf("the '%s' command failed via %s: %s", cmd, sock, err)
+	}
+	if resp.Error != nil {
+		return "", &appctlError{fmt.Sprintf("the '%s' command failed via %s: %v", cmd, sock, resp.Error)}
+	}
+	if resp.Result == nil {
+		return "", fmt.Errorf("the '%s' command return no data via %s", cmd, sock)
+	}
+	return *resp.Result, nil
+}
+
+// hasCommand returns true when a daemon supports a command. The keys of
+// cmds are the lines of `ovs-appctl list-commands` and include the usage of
+// a command, e.g. "dpctl/offload-stats-show [dp]".
+func hasCommand(cmds map[string]bool, cmd string) bool {
+	for line := range cmds {
+		if line == cmd || strings.HasPrefix(line, cmd+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// controlSocket returns the path to the control socket of an OVS daemon. The
+// path embeds the process ID of the daemon. When the ID is not known yet, it
+// is resolved via the daemon's pid file.
+func (c *ovsClient) controlSocket(component string) (string, error) {
+	switch component {
+	case "ovsdb-server":
+		if c.cli.Database.Vswitch.Process.ID == 0 {
+			if _, err := c.cli.GetProcessInfo("ovsdb-server"); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%s/ovsdb-server.%d.ctl", c.cli.System.RunDir, c.cli.Database.Vswitch.Process.ID), nil
+	case "vswitchd-service":
+		if c.cli.Service.Vswitchd.Process.ID == 0 {
+			if _, err := c.cli.GetProcessInfo("ovs-vswitchd"); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%s/ovs-vswitchd.%d.ctl", c.cli.System.RunDir, c.cli.Service.Vswitchd.Process.ID), nil
+	case "ovncontroller-service":
+		if c.cli.Service.OvnController.Process.ID == 0 {
+			if _, err := c.cli.GetProcessInfo("ovn-controller"); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%s/ovn-controller.%d.ctl", c.cli.System.RunDirOvn, c.cli.Service.OvnController.Process.ID), nil
+	}
+	return "", fmt.Errorf("The '%s' component is unsupported", component)
+}
+
+// appctl runs an ovs-appctl command against the daemon behind the component.
+func (c *ovsClient) appctl(component string, cmd string, args ...string) (string, error) {
+	sock, err := c.controlSocket(component)
+	if err != nil {
+		return "", err
+	}
+	return appctl(sock, c.cli.Timeout, cmd, args...)
+}
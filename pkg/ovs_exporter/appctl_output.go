@@ -0,0 +1,364 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The parsers of ovs-appctl output never panic. Output they cannot make
+// sense of is reported as an error, which fails the collector, instead of
+// being turned into bogus values. Label values taken from the output are
+// valid UTF-8, as required by prometheus.MustNewConstMetric.
+
+// parseCounter parses a non-negative, finite number.
+func parseCounter(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// checkOutput returns an error when the output of a command is empty or is
+// not valid UTF-8.
+func checkOutput(cmd string, s string) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("the '%s' command return no data", cmd)
+	}
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("the '%s' command return invalid UTF-8", cmd)
+	}
+	return nil
+}
+
+// indentDepths maps the indentation of the lines of an output to their
+// nesting depth, e.g. 0, 2 and 4 spaces to depth 0, 1 and 2.
+func indentDepths(lines []string) map[int]int {
+	indents := []int{}
+	seen := make(map[int]bool)
+	for _, line := range lines {
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.TrimSpace(line) == "" {
+			indent = 0
+		}
+		if !seen[indent] {
+			seen[indent] = true
+			indents = append(indents, indent)
+		}
+	}
+	sort.Ints(indents)
+	depths := make(map[int]int)
+	for i, indent := range indents {
+		depths[indent] = i
+	}
+	return depths
+}
+
+// parseCoverage parses the output of `ovs-appctl coverage/show`, e.g.
+// "netlink_sent  15.2/sec  14.983/sec  14.8694/sec   total: 81034". It
+// returns the 5s, 5m and 1h averages and the total by event.
+func parseCoverage(s string) (map[string]map[string]float64, error) {
+	cmd := "coverage/show"
+	if err := checkOutput(cmd, s); err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]map[string]float64)
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 6 || fields[4] != "total:" {
+			// e.g. "Event coverage, avg rate over last: ..." or
+			// "87 events never hit"
+			continue
+		}
+		event := make(map[string]float64)
+		for i, period := range []string{"5s", "5m", "1h"} {
+			v, err := parseCounter(strings.TrimSuffix(fields[i+1], "/sec"))
+			if err != nil {
+				return nil, fmt.Errorf("the '%s' command return for %s failed output analysis: %s", cmd, fields[0], err)
+			}
+			event[period] = v
+		}
+		total, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("the '%s' command return for %s failed output analysis: %s", cmd, fields[0], err)
+		}
+		event["total"] = float64(total)
+		metrics[fields[0]] = event
+	}
+	return metrics, nil
+}
+
+// parseMemory parses the output of `ovs-appctl memory/show`, e.g.
+// "handlers:4 ports:7 revalidators:2 rules:142 udpif keys:38". Items
+// without a numeric value are skipped.
+func parseMemory(s string) (map[string]float64, error) {
+	cmd := "memory/show"
+	if err := checkOutput(cmd, s); err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]float64)
+	for _, item := range strings.Fields(s) {
+		kv := strings.Split(item, ":")
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			continue
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+			return nil, fmt.Errorf("the '%s' command return for %s failed output analysis: invalid value %q", cmd, kv[0], kv[1])
+		}
+		metrics[kv[0]] = v
+	}
+	return metrics, nil
+}
+
+// parseDpifShow parses the output of `ovs-appctl dpif/show`, i.e. the
+// bridges of each datapath and their interfaces, e.g.
+//
+//	system@ovs-system: hit:182317 missed:12842
+//	  br-int:
+//	    br-int 65534/1: (internal)
+//	    ovn-hv2-0 1/2: (geneve: packet_type=ptap)
+func parseDpifShow(s string) ([]*Bridge, []*Interface, error) {
+	cmd := "dpif/show"
+	brs := []*Bridge{}
+	intfs := []*Interface{}
+	if err := checkOutput(cmd, s); err != nil {
+		return brs, intfs, err
+	}
+	lines := strings.Split(s, "\n")
+	depths := indentDepths(lines)
+	var dpn, brn string
+	for _, line := range lines {
+		depth := depths[len(line)-len(strings.TrimLeft(line, " "))]
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		switch depth {
+		case 0:
+			i := strings.Index(line, ":")
+			if i < 1 {
+				return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis: datapath string", cmd)
+			}
+			dpn = line[:i]
+		case 1:
+			brn = strings.TrimRight(line, ":")
+			if brn == "" {
+				return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis: bridge string", cmd)
+			}
+			brs = append(brs, &Bridge{
+				Name:         brn,
+				DatapathName: dpn,
+			})
+		case 2:
+			intf := &Interface{
+				BridgeName:   brn,
+				DatapathName: dpn,
+			}
+			i := strings.IndexAny(line, " \t")
+			if i < 0 {
+				return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis: interface string", cmd)
+			}
+			intf.Name = line[:i]
+			line = line[i:]
+			i = strings.Index(line, ":")
+			if i < 0 {
+				return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis: interface %s", cmd, intf.Name)
+			}
+			ids := strings.Split(line[:i], "/")
+			if len(ids) != 2 {
+				return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis: interface %s identifiers", cmd, intf.Name)
+			}
+			// The port numbers are "none" for e.g. patch ports.
+			if v, err := parseCounter(strings.TrimSpace(ids[0])); err == nil {
+				intf.OfPort = v
+			}
+			if v, err := parseCounter(strings.TrimSpace(ids[1])); err == nil {
+				intf.Index = v
+			}
+			i = strings.Index(line, "(")
+			if i < 0 {
+				return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis: interface %s attributes", cmd, intf.Name)
+			}
+			attrs := strings.TrimLeft(strings.TrimRight(line[i:], ")"), "(")
+			switch {
+			case attrs == "internal":
+				intf.Type = "internal"
+			case attrs == "system":
+				intf.Type = "system"
+			case strings.HasPrefix(attrs, "vxlan"):
+				intf.Type = "vxlan"
+			case strings.HasPrefix(attrs, "geneve"):
+				intf.Type = "geneve"
+			default:
+				intf.Type = "unknown"
+			}
+			intfs = append(intfs, intf)
+		default:
+			return brs, intfs, fmt.Errorf("the '%s' command return failed output analysis", cmd)
+		}
+	}
+	return brs, intfs, nil
+}
+
+// parseDatapathCounters parses counters like "hit:182317 missed:12842
+// lost:0" into the fields of a datapath. Unknown counters, e.g. ones added
+// by a newer OVS release, are skipped. A known counter without a valid
+// value is an error.
+func parseDatapathCounters(s string, fields map[string]*float64) error {
+	for _, item := range strings.Fields(s) {
+		kv := strings.Split(item, ":")
+		if len(kv) != 2 {
+			continue
+		}
+		field, exists := fields[kv[0]]
+		if !exists {
+			continue
+		}
+		v, err := parseCounter(kv[1])
+		if err != nil {
+			return fmt.Errorf("malformed counter %s: %s", kv[0], err)
+		}
+		*field = v
+	}
+	return nil
+}
+
+// parseDpctlShow parses the output of `ovs-appctl dpctl/show`, i.e. the
+// lookup, flow and mask counters of each datapath, e.g.
+//
+//	system@ovs-system:
+//	  lookups: hit:182317 missed:12842 lost:0
+//	  flows: 27
+//	  masks: hit:401235 total:9 hit/pkt:2.06
+//	  port 0: ovs-system (internal)
+func parseDpctlShow(s string) ([]*Datapath, error) {
+	cmd := "dpctl/show"
+	dps := []*Datapath{}
+	if err := checkOutput(cmd, s); err != nil {
+		return dps, err
+	}
+	lines := strings.Split(s, "\n")
+	depths := indentDepths(lines)
+	var dp *Datapath
+	for _, line := range lines {
+		depth := depths[len(line)-len(strings.TrimLeft(line, " "))]
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, ":")
+		switch depth {
+		case 0:
+			if i < 1 {
+				return dps, fmt.Errorf("the '%s' command return failed output analysis: datapath string", cmd)
+			}
+			dp = &Datapath{Name: line[:i]}
+			dps = append(dps, dp)
+		case 1, 2:
+			if dp == nil || i < 0 {
+				continue
+			}
+			switch line[:i] {
+			case "lookups":
+				if err := parseDatapathCounters(line[i+1:], map[string]*float64{
+					"hit":    &dp.Lookups.Hit,
+					"missed": &dp.Lookups.Missed,
+					"lost":   &dp.Lookups.Lost,
+				}); err != nil {
+					return dps, fmt.Errorf("the '%s' command return failed output analysis: datapath lookup counters: %s", cmd, err)
+				}
+			case "flows":
+				if v, err := parseCounter(strings.TrimSpace(line[i+1:])); err == nil {
+					dp.Flows = v
+				}
+			case "masks":
+				if err := parseDatapathCounters(line[i+1:], map[string]*float64{
+					"hit":     &dp.Masks.Hit,
+					"total":   &dp.Masks.Total,
+					"hit/pkt": &dp.Masks.HitRatio,
+				}); err != nil {
+					return dps, fmt.Errorf("the '%s' command return failed output analysis: datapath masks counters: %s", cmd, err)
+				}
+			}
+		default:
+			return dps, fmt.Errorf("the '%s' command return failed output analysis", cmd)
+		}
+	}
+	return dps, nil
+}
+
+// GetAppCoverageMetrics returns the coverage counters of the daemon behind
+// a component.
+func (c *ovsClient) GetAppCoverageMetrics(component string) (map[string]map[string]float64, error) {
+	c.Lock()
+	defer c.Unlock()
+	output, err := c.appctl(component, "coverage/show")
+	if err != nil {
+		return nil, err
+	}
+	return parseCoverage(output)
+}
+
+// GetAppMemoryMetrics returns the memory usage counters of the daemon
+// behind a component.
+func (c *ovsClient) GetAppMemoryMetrics(component string) (map[string]float64, error) {
+	c.Lock()
+	defer c.Unlock()
+	output, err := c.appctl(component, "memory/show")
+	if err != nil {
+		return nil, err
+	}
+	return parseMemory(output)
+}
+
+// GetAppDatapath returns the datapaths of ovs-vswitchd with their counters
+// from dpctl/show, and their bridges and interfaces from dpif/show.
+func (c *ovsClient) GetAppDatapath(component string) ([]*Datapath, []*Bridge, []*Interface, error) {
+	c.Lock()
+	defer c.Unlock()
+	if component != "vswitchd-service" {
+		return nil, nil, nil, fmt.Errorf("The '%s' component is unsupported for 'dpif/show'", component)
+	}
+	output, err := c.appctl(component, "dpif/show")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	brs, intfs, err := parseDpifShow(output)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	output, err = c.appctl(component, "dpctl/show")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dps, err := parseDpctlShow(output)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return dps, brs, intfs, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMalformedAppctlOutput(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	// A datapath line without a colon made the dpctl/show parser of
+	// ovsdbclient panic.
+	fake.setReply("ovs-vswitchd", "dpctl/show", "system@ovs-system\n  lookups: hit:1 missed:2 lost:0\n")
+	fake.setReply("ovsdb-server", "coverage/show", "hmap_expand  NaN/sec  0.0/sec  0.0/sec   total: 5\n")
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	exporter.SetPollInterval(15)
+	exporter.GatherMetrics()
+
+	if len(exporter.pollErrors["datapath"]) != 1 || len(exporter.pollErrors["coverage"]) != 1 {
+		t.Fatalf("expected the datapath and coverage collectors to fail, got %v", exporter.pollErrors)
+	}
+	expected := `
+# HELP ovs_collector_success Whether a collector succeeded (1) or failed (0) in the last poll, e.g. because OVS refused a command or returned output that could not be parsed.
+# TYPE ovs_collector_success gauge
+ovs_collector_success{collector="appctl",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_collector_success{collector="coverage",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 0
+ovs_collector_success{collector="datapath",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 0
+ovs_collector_success{collector="interfaces",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_collector_success{collector="log",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_collector_success{collector="memory",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_collector_success{collector="network_port",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_collector_success{collector="process",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_collector_success{collector="system",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "ovs_collector_success"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDpctlShowCounters(t *testing.T) {
+	// Counters unknown to the exporter are skipped.
+	dps, err := parseDpctlShow("system@ovs-system:\n" +
+		"  lookups: hit:182317 missed:12842 lost:0 upcall:7\n" +
+		"  flows: 27\n" +
+		"  masks: hit:401235 total:9 hit/pkt:2.06 cache-hit:12\n")
+	if err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if len(dps) != 1 || dps[0].Lookups.Hit != 182317 || dps[0].Lookups.Missed != 12842 || dps[0].Masks.Total != 9 || dps[0].Masks.HitRatio != 2.06 {
+		t.Fatalf("unexpected datapaths: %+v", dps)
+	}
+
+	// A known counter with a malformed value is an error.
+	for _, s := range []string{
+		"system@ovs-system:\n  lookups: hit:NaN missed:0 lost:0\n",
+		"system@ovs-system:\n  masks: hit:1 total:-9 hit/pkt:1.00\n",
+	} {
+		if _, err := parseDpctlShow(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The benchmarks poll and scrape a fake OVS with thousands of interfaces,
+// like the hypervisors of large OpenStack deployments. Run e.g.
+// `go test -run '^$' -bench . -benchmem` to measure the latency and
+// allocations of a poll and the size of a scrape.
+
+var benchmarkScales = []int{1000, 5000, 20000}
+
+// benchmarkCoverageEvents is the number of coverage events each daemon
+// reports, several times the number of a busy ovs-vswitchd.
+const benchmarkCoverageEvents = 1000
+
+// newScaleOVS returns a fake OVS whose br-int bridge carries n VM
+// interfaces in addition to the interfaces of the 2.17 fixture.
+func newScaleOVS(b *testing.B, n int) *fakeOVS {
+	b.Helper()
+	fake := newFakeOVS(b, "2.17")
+	bridges := fake.selectRows("Bridge", nil)
+	ports := fake.selectRows("Port", nil)
+	intfs := fake.selectRows("Interface", nil)
+	var dpif strings.Builder
+	dpif.WriteString(fake.replies["ovs-vswitchd"]["dpif/show"])
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("tap%08x-%02x", i, i%256)
+		portUUID := fmt.Sprintf("5d7a1f0e-0000-0000-0000-%012d", i)
+		intfUUID := fmt.Sprintf("9e3f2a1b-0000-0000-0000-%012d", i)
+		mac := fmt.Sprintf("fa:16:3e:%02x:%02x:%02x", i>>16&0xff, i>>8&0xff, i&0xff)
+		ports = append(ports, map[string]interface{}{
+			"_uuid":      []interface{}{"uuid", portUUID},
+			"name":       name,
+			"interfaces": []interface{}{"uuid", intfUUID},
+		})
+		intfs = append(intfs, map[string]interface{}{
+			"_uuid":       []interface{}{"uuid", intfUUID},
+			"name":        name,
+			"type":        "",
+			"ofport":      i + 10,
+			"ifindex":     i + 100,
+			"mtu":         1442,
+			"mac_in_use":  mac,
+			"admin_state": "up",
+			"link_state":  "up",
+			"link_speed":  10000000,
+			"duplex":      "full",
+			"statistics": []interface{}{"map", []interface{}{
+				[]interface{}{"collisions", 0},
+				[]interface{}{"rx_bytes", 123456789 + i},
+				[]interface{}{"rx_crc_err", 0},
+				[]interface{}{"rx_dropped", i % 7},
+				[]interface{}{"rx_errors", 0},
+				[]interface{}{"rx_frame_err", 0},
+				[]interface{}{"rx_missed_errors", 0},
+				[]interface{}{"rx_over_err", 0},
+				[]interface{}{"rx_packets", 234567 + i},
+				[]interface{}{"tx_bytes", 987654321 + i},
+				[]interface{}{"tx_dropped", 0},
+				[]interface{}{"tx_errors", 0},
+				[]interface{}{"tx_packets", 345678 + i},
+			}},
+			"status": []interface{}{"map", []interface{}{
+				[]interface{}{"driver_name", "tun"},
+				[]interface{}{"driver_version", "1.6"},
+			}},
+			"external_ids": []interface{}{"map", []interface{}{
+				[]interface{}{"attached-mac", mac},
+				[]interface{}{"iface-id", fmt.Sprintf("c0ffee00-0000-0000-0000-%012d", i)},
+				[]interface{}{"iface-status", "active"},
+				[]interface{}{"vm-uuid", fmt.Sprintf("facade00-0000-0000-0000-%012d", i/4)},
+			}},
+		})
+		fmt.Fprintf(&dpif, "    %s %d/%d: (system)\n", name, i+10, i+10)
+	}
+	for _, br := range bridges {
+		if br["name"] != "br-int" {
+			continue
+		}
+		set := br["ports"].([]interface{})
+		uuids := append([]interface{}{}, set[1].([]interface{})...)
+		for i := 0; i < n; i++ {
+			uuids = append(uuids, []interface{}{"uuid", fmt.Sprintf("5d7a1f0e-0000-0000-0000-%012d", i)})
+		}
+		br["ports"] = []interface{}{"set", uuids}
+	}
+	fake.setRows("Bridge", bridges)
+	fake.setRows("Port", ports)
+	fake.setRows("Interface", intfs)
+	// The VM interfaces are appended to the last bridge of dpif/show, br-int.
+	fake.setReply("ovs-vswitchd", "dpif/show", dpif.String())
+
+	var coverage strings.Builder
+	coverage.WriteString("Event coverage, avg rate over last: 5 seconds, last minute, last hour,  hash=4ee4ab5b:\n")
+	for i := 0; i < benchmarkCoverageEvents; i++ {
+		fmt.Fprintf(&coverage, "event_%04d  %d.2/sec  %d.317/sec  %d.3161/sec   total: %d\n", i, i%10, i%100, i, i*1000)
+	}
+	for _, daemon := range fakeDaemons {
+		fake.setReply(daemon, "coverage/show", coverage.String())
+	}
+	return fake
+}
+
+func newScaleExporter(b *testing.B, fake *fakeOVS) *Exporter {
+	b.Helper()
+	logger, err := NewLogger("error")
+	if err != nil {
+		b.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(10),
+		WithLogger(logger),
+	)
+	if err := exporter.Connect(); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(exporter.Close)
+	exporter.SetPollInterval(3600)
+	return exporter
+}
+
+// BenchmarkGatherMetrics measures a poll of OVS, from the queries to the
+// creation of the metrics.
+func BenchmarkGatherMetrics(b *testing.B) {
+	for _, n := range benchmarkScales {
+		b.Run(fmt.Sprintf("interfaces=%d", n), func(b *testing.B) {
+			exporter := newScaleExporter(b, newScaleOVS(b, n))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				exporter.nextCollectionTicker = 0
+				exporter.GatherMetrics()
+			}
+			b.StopTimer()
+			if len(exporter.pollErrors) != 0 {
+				b.Fatalf("unexpected errors: %v", exporter.pollErrors)
+			}
+			b.ReportMetric(float64(len(exporter.metrics)), "metrics/op")
+		})
+	}
+}
+
+// BenchmarkScrape measures the encoding of the metrics of the last poll
+// for a scrape, as done by promhttp, and the size of the response, both
+// uncompressed and gzip-compressed as requested by Prometheus.
+func BenchmarkScrape(b *testing.B) {
+	for _, n := range benchmarkScales {
+		for _, encoding := range []string{"identity", "gzip"} {
+			b.Run(fmt.Sprintf("interfaces=%d/encoding=%s", n, encoding), func(b *testing.B) {
+				exporter := newScaleExporter(b, newScaleOVS(b, n))
+				exporter.GatherMetrics()
+				registry := prometheus.NewRegistry()
+				registry.MustRegister(exporter)
+				handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+				req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+				req.Header.Set("Accept-Encoding", encoding)
+				var size int
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					rec := httptest.NewRecorder()
+					handler.ServeHTTP(rec, req)
+					if rec.Code != http.StatusOK {
+						b.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+					}
+					size = rec.Body.Len()
+				}
+				b.ReportMetric(float64(size), "bytes/scrape")
+			})
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/syseleven/ovsdbclient"
+)
+
+// Client is the interface of the exporter to OVS. The default client, see
+// NewClient, queries ovsdb-server via JSON-RPC and the OVS daemons via
+// their control sockets. Other backends, e.g. fakes or remote agents, are
+// passed to the exporter with WithClient.
+//
+// The components of the appctl methods, i.e. the GetApp methods, are
+// ovsdb-server, vswitchd-service and ovncontroller-service. The daemons of
+// the other methods are ovsdb-server, ovs-vswitchd and ovn-controller.
+type Client interface {
+	// Connect connects to OVSDB.
+	Connect() error
+	// Close closes the connection to OVSDB.
+	Close()
+	// GetSystemInfo returns the system ID and the versions of OVS. On
+	// error, the information known so far is returned, e.g. the system ID.
+	GetSystemInfo() (SystemInfo, error)
+	// GetProcessInfo returns the process of a daemon. On error, the
+	// information known so far is returned, e.g. the process ID.
+	GetProcessInfo(daemon string) (Process, error)
+	// GetLogFileInfo returns the log file of a daemon.
+	GetLogFileInfo(daemon string) (LogFile, error)
+	// IsDefaultPortUp returns 1 when a daemon listens on its TCP port.
+	IsDefaultPortUp(daemon string) (int, error)
+	// IsSslPortUp returns 1 when a daemon listens on its SSL port.
+	IsSslPortUp(daemon string) (int, error)
+	// GetDbBridges returns the bridges of the Bridge table.
+	GetDbBridges() ([]*Bridge, error)
+	// GetDbPorts returns the ports of the Port table.
+	GetDbPorts() ([]*Port, error)
+	// GetDbInterfaces returns the interfaces of the Interface table,
+	// together with the names of their bridges.
+	GetDbInterfaces() ([]*Interface, error)
+	// GetDbOtherConfig returns the other_config column of the Open_vSwitch
+	// table.
+	GetDbOtherConfig() (map[string]string, error)
+	// AppListCommands returns the commands supported by the daemon behind
+	// a component.
+	AppListCommands(component string) (map[string]bool, error)
+	// GetAppCoverageMetrics returns the coverage counters of the daemon
+	// behind a component, by event and period.
+	GetAppCoverageMetrics(component string) (map[string]map[string]float64, error)
+	// GetAppMemoryMetrics returns the memory usage counters of the daemon
+	// behind a component.
+	GetAppMemoryMetrics(component string) (map[string]float64, error)
+	// GetAppDatapath returns the datapaths of ovs-vswitchd, and their
+	// bridges and interfaces.
+	GetAppDatapath(component string) ([]*Datapath, []*Bridge, []*Interface, error)
+	// GetAppDatapathFlows returns the flows of a datapath. It returns at
+	// most limit flows, if limit is positive, and reports whether there
+	// were more.
+	GetAppDatapathFlows(component string, datapath string, limit int) ([]*DatapathFlow, bool, error)
+	// GetAppDatapathFlowCount returns the number of flows of a datapath by
+	// offload type, i.e. offloaded or non-offloaded.
+	GetAppDatapathFlowCount(component string, datapath string, flowType string) (int, error)
+	// GetAppOffloadStats returns the hardware offload statistics of a
+	// datapath. A datapath without offload support, e.g. the kernel
+	// datapath, has no statistics; nil is returned without error.
+	GetAppOffloadStats(component string, datapath string) (map[string]float64, error)
+}
+
+// SystemInfo describes the OVS installation of a host, as reported by the
+// Open_vSwitch table.
+type SystemInfo struct {
+	ID         string
+	RunDir     string
+	Hostname   string
+	Type       string
+	Version    string
+	OvsVersion string
+	DbVersion  string
+}
+
+// Process is the process of an OVS daemon.
+type Process struct {
+	ID    int
+	User  string
+	Group string
+}
+
+// LogFile is the log file of an OVS daemon.
+type LogFile struct {
+	Path      string
+	Component string
+	Info      os.FileInfo
+}
+
+// Bridge is a bridge of the Bridge table, or of `ovs-appctl dpif/show`,
+// which only reports the name and the datapath.
+type Bridge struct {
+	UUID         string
+	Name         string
+	DatapathName string // reference from ovs-appctl dpif/show
+	DatapathType string
+	FailMode     string
+	ExternalIDs  map[string]string
+	Ports        []string
+}
+
+// Port is a port of the Port table.
+type Port struct {
+	UUID        string
+	Name        string
+	Interfaces  []string
+	Tag         *int64
+	Trunks      []int64
+	VlanMode    string
+	ExternalIDs map[string]string
+}
+
+// Interface is an interface of the Interface table, or a datapath port of
+// `ovs-appctl dpif/show`, which reports the name, the index, the bridge, the
+// datapath, the OpenFlow port and the type.
+type Interface struct {
+	UUID                 string
+	Name                 string
+	Index                float64 // reference from ovs-appctl dpif/show
+	BridgeName           string
+	DatapathName         string // reference from ovs-appctl dpif/show
+	Type                 string
+	AdminState           string
+	LinkState            string
+	LinkSpeed            float64
+	LinkResets           float64
+	Duplex               string
+	MacInUse             string
+	Mtu                  float64
+	OfPort               float64
+	IfIndex              float64
+	IngressPolicingBurst float64
+	IngressPolicingRate  float64
+	ExternalIDs          map[string]string
+	Options              map[string]string
+	Status               map[string]string
+	Statistics           map[string]int
+}
+
+// Datapath is a datapath of `ovs-appctl dpctl/show` with its counters.
+type Datapath struct {
+	Name    string
+	Lookups struct {
+		Hit    float64
+		Missed float64
+		Lost   float64
+	}
+	Flows float64
+	Masks struct {
+		Hit      float64
+		Total    float64
+		HitRatio float64
+	}
+}
+
+// ClientConfig tells the default client where to find OVS.
+type ClientConfig struct {
+	// RunDir and RunDirOvn are the directories of the control sockets of
+	// the OVS and OVN daemons. The OVS run directory found in OVSDB takes
+	// precedence once the system information was read.
+	RunDir    string
+	RunDirOvn string
+
+	// DatabaseName is the name of the OVS database, and DatabaseRemote the
+	// JSON-RPC socket of ovsdb-server, e.g. unix:/var/run/openvswitch/db.sock
+	// or ssl:192.0.2.1:6640.
+	DatabaseName   string
+	DatabaseRemote string
+
+	// PrivateKeyFile, CertificateFile and CACertFile are the PEM files of
+	// the private key and the certificate of the exporter, and of the CA
+	// certificates verifying the server, for ssl: remotes. They correspond
+	// to the -p, -c and -C options of ovsdb-client.
+	PrivateKeyFile  string
+	CertificateFile string
+	CACertFile      string
+
+	DatabaseFile         string
+	DatabaseLogFile      string
+	DatabasePidFile      string
+	SystemIDFile         string
+	VswitchdLogFile      string
+	VswitchdPidFile      string
+	OvnControllerLogFile string
+	OvnControllerPidFile string
+}
+
+// DefaultClientConfig returns the configuration of a typical installation
+// of OVS and OVN.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		RunDir:               "/var/run/openvswitch",
+		RunDirOvn:            "/var/run/ovn",
+		DatabaseName:         "Open_vSwitch",
+		DatabaseRemote:       "unix:/var/run/openvswitch/db.sock",
+		DatabaseFile:         "/etc/openvswitch/conf.db",
+		DatabaseLogFile:      "/var/log/openvswitch/ovsdb-server.log",
+		DatabasePidFile:      "/var/run/openvswitch/ovsdb-server.pid",
+		SystemIDFile:         "/etc/openvswitch/system-id.conf",
+		VswitchdLogFile:      "/var/log/openvswitch/ovs-vswitchd.log",
+		VswitchdPidFile:      "/var/run/openvswitch/ovs-vswitchd.pid",
+		OvnControllerLogFile: "/var/log/ovn/ovn-controller.log",
+		OvnControllerPidFile: "/var/run/ovn/ovn-controller.pid",
+	}
+}
+
+// defaultSystemInfo returns the system information reported before it was
+// read from OVSDB.
+func defaultSystemInfo(config ClientConfig) SystemInfo {
+	return SystemInfo{
+		ID:         "unknown",
+		RunDir:     config.RunDir,
+		Hostname:   "localhost",
+		Type:       "unknown",
+		Version:    "unknown",
+		OvsVersion: "unknown",
+		DbVersion:  "unknown",
+	}
+}
+
+// ovsClient is the default client, built on ovsdbclient. The OvsClient of
+// ovsdbclient is not safe for concurrent use, e.g. it caches the columns of
+// queries and the process IDs of the daemons. Each method therefore holds
+// the mutex while it uses cli, so that the topology handler can share the
+// client with polls.
+type ovsClient struct {
+	sync.Mutex
+	cli    *ovsdbclient.OvsClient
+	config ClientConfig
+	tunnel *tlsTunnel
+	logger slog.Logger
+}
+
+// NewClient returns the default client. The timeout of its requests is in
+// seconds. The logger is used by the TLS tunnel of ssl: remotes.
+func NewClient(config ClientConfig, timeout int, logger slog.Logger) Client {
+	cli := ovsdbclient.NewOvsClient()
+	cli.Timeout = timeout
+	cli.System.RunDir = config.RunDir
+	cli.System.RunDirOvn = config.RunDirOvn
+	cli.Database.Vswitch.Name = config.DatabaseName
+	cli.Database.Vswitch.Socket.Remote = config.DatabaseRemote
+	cli.Database.Vswitch.File.Data.Path = config.DatabaseFile
+	cli.Database.Vswitch.File.Log.Path = config.DatabaseLogFile
+	cli.Database.Vswitch.File.Pid.Path = config.DatabasePidFile
+	cli.Database.Vswitch.File.SystemID.Path = config.SystemIDFile
+	cli.Service.Vswitchd.File.Log.Path = config.VswitchdLogFile
+	cli.Service.Vswitchd.File.Pid.Path = config.VswitchdPidFile
+	cli.Service.OvnController.File.Log.Path = config.OvnControllerLogFile
+	cli.Service.OvnController.File.Pid.Path = config.OvnControllerPidFile
+	return &ovsClient{cli: cli, config: config, logger: logger}
+}
+
+func (c *ovsClient) Connect() error {
+	c.Lock()
+	defer c.Unlock()
+	c.cli.GetSystemID()
+	if isSslRemote(c.config.DatabaseRemote) && c.tunnel == nil {
+		tunnel, err := newTLSTunnel(c.config, c.cli.Timeout, c.logger)
+		if err != nil {
+			return fmt.Errorf("failed connecting to %s via %s: %s", c.config.DatabaseName, c.config.DatabaseRemote, err)
+		}
+		c.tunnel = tunnel
+		c.cli.Database.Vswitch.Socket.Remote = tunnel.remote()
+	}
+	return c.cli.Connect()
+}
+
+func (c *ovsClient) Close() {
+	c.Lock()
+	defer c.Unlock()
+	c.cli.Close()
+	if c.tunnel != nil {
+		c.tunnel.close()
+		c.tunnel = nil
+	}
+}
+
+func (c *ovsClient) GetSystemInfo() (SystemInfo, error) {
+	c.Lock()
+	defer c.Unlock()
+	err := c.cli.GetSystemInfo()
+	return SystemInfo{
+		ID:         c.cli.System.ID,
+		RunDir:     c.cli.System.RunDir,
+		Hostname:   c.cli.System.Hostname,
+		Type:       c.cli.System.Type,
+		Version:    c.cli.System.Version,
+		OvsVersion: c.cli.Database.Vswitch.Version,
+		DbVersion:  c.cli.Database.Vswitch.Schema.Version,
+	}, err
+}
+
+func (c *ovsClient) GetProcessInfo(daemon string) (Process, error) {
+	c.Lock()
+	defer c.Unlock()
+	p, err := c.cli.GetProcessInfo(daemon)
+	return Process{ID: p.ID, User: p.User, Group: p.Group}, err
+}
+
+func (c *ovsClient) GetLogFileInfo(daemon string) (LogFile, error) {
+	c.Lock()
+	defer c.Unlock()
+	f, err := c.cli.GetLogFileInfo(daemon)
+	return LogFile{Path: f.Path, Component: f.Component, Info: f.Info}, err
+}
+
+func (c *ovsClient) IsDefaultPortUp(daemon string) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.cli.IsDefaultPortUp(daemon)
+}
+
+func (c *ovsClient) IsSslPortUp(daemon string) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.cli.IsSslPortUp(daemon)
+}
+
+func (c *ovsClient) AppListCommands(component string) (map[string]bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.cli.AppListCommands(component)
+}
+
+// transact runs a query against the Open_vSwitch database.
+func (c *ovsClient) transact(query string) (ovsdbclient.Result, error) {
+	if c.cli.Database.Vswitch.Client == nil {
+		return ovsdbclient.Result{}, fmt.Errorf("not connected to %s", c.cli.Database.Vswitch.Name)
+	}
+	return c.cli.Database.Vswitch.Client.Transact(c.cli.Database.Vswitch.Name, query)
+}
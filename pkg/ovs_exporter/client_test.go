@@ -0,0 +1,158 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// staticClient is a backend answering from memory, without OVS.
+type staticClient struct {
+	system SystemInfo
+	intfs  []*Interface
+}
+
+func (c *staticClient) Connect() error { return nil }
+
+func (c *staticClient) Close() {}
+
+func (c *staticClient) GetSystemInfo() (SystemInfo, error) { return c.system, nil }
+
+func (c *staticClient) GetProcessInfo(daemon string) (Process, error) {
+	return Process{ID: 100, User: "openvswitch", Group: "openvswitch"}, nil
+}
+
+func (c *staticClient) GetLogFileInfo(daemon string) (LogFile, error) {
+	return LogFile{}, fmt.Errorf("no log file")
+}
+
+func (c *staticClient) IsDefaultPortUp(daemon string) (int, error) { return 0, nil }
+
+func (c *staticClient) IsSslPortUp(daemon string) (int, error) { return 1, nil }
+
+func (c *staticClient) GetDbBridges() ([]*Bridge, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) GetDbPorts() ([]*Port, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) GetDbInterfaces() ([]*Interface, error) {
+	return c.intfs, nil
+}
+
+func (c *staticClient) GetDbOtherConfig() (map[string]string, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) AppListCommands(component string) (map[string]bool, error) {
+	if component != "vswitchd-service" {
+		return nil, fmt.Errorf("%s is not running", component)
+	}
+	return map[string]bool{"coverage/show": true}, nil
+}
+
+func (c *staticClient) GetAppCoverageMetrics(component string) (map[string]map[string]float64, error) {
+	return map[string]map[string]float64{
+		"netdev_sent": {"total": 42, "5s": 1},
+	}, nil
+}
+
+func (c *staticClient) GetAppMemoryMetrics(component string) (map[string]float64, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) GetAppDatapath(component string) ([]*Datapath, []*Bridge, []*Interface, error) {
+	return nil, nil, nil, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) GetAppDatapathFlows(component string, datapath string, limit int) ([]*DatapathFlow, bool, error) {
+	return nil, false, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) GetAppDatapathFlowCount(component string, datapath string, flowType string) (int, error) {
+	return 0, fmt.Errorf("unsupported")
+}
+
+func (c *staticClient) GetAppOffloadStats(component string, datapath string) (map[string]float64, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+func TestClient(t *testing.T) {
+	logger, err := NewLoggerWithWriter("error", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &staticClient{
+		system: SystemInfo{
+			ID:         "4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",
+			RunDir:     "/var/run/openvswitch",
+			Hostname:   "hv1",
+			Type:       "ubuntu",
+			Version:    "22.04",
+			OvsVersion: "3.3.0",
+			DbVersion:  "8.5.0",
+		},
+		intfs: []*Interface{
+			{
+				UUID:       "9b7f2c1e-3f3a-4d51-9d1a-5e0f2b1c7a10",
+				Name:       "tap0",
+				LinkState:  "up",
+				AdminState: "up",
+				Statistics: map[string]int{"rx_packets": 5},
+			},
+		},
+	}
+	exporter := NewExporter(WithClient(client), WithLogger(logger))
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+	if id := exporter.SystemInfo().ID; id != client.system.ID {
+		t.Errorf("expected system id %q, but got %q", client.system.ID, id)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	expected := `
+# HELP ovs_info This metric provides basic information about OVN stack. It is always set to 1.
+# TYPE ovs_info gauge
+ovs_info{db_version="8.5.0",hostname="hv1",ovs_version="3.3.0",rundir="/var/run/openvswitch",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",system_type="ubuntu",system_version="22.04"} 1
+# HELP ovs_coverage_total The total number of times particular events occur during a OVSDB daemon's runtime.
+# TYPE ovs_coverage_total counter
+ovs_coverage_total{component="vswitchd-service",event="netdev_sent",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 42
+# HELP ovs_interface_rx_packets Represents the number of received packets by OVS interface.
+# TYPE ovs_interface_rx_packets counter
+ovs_interface_rx_packets{name="tap0",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",uuid="9b7f2c1e-3f3a-4d51-9d1a-5e0f2b1c7a10"} 5
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"ovs_info", "ovs_coverage_total", "ovs_interface_rx_packets"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientRecordMode(t *testing.T) {
+	exporter := NewExporter(WithClient(&staticClient{}), WithRecordDir(t.TempDir()))
+	if err := exporter.Connect(); err == nil {
+		t.Fatal("expected record mode to fail with a client other than the default one")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EventFilter selects coverage events by name. An event passes the filter
+// when it matches any of the include patterns, or there are none, and it
+// matches none of the exclude patterns. Patterns are regular expressions
+// matched against the whole event name.
+type EventFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func compileEventPatterns(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid event pattern %q: %s", p, err)
+		}
+	}
+	return regexp.Compile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+// NewEventFilter returns an EventFilter for the given include and exclude
+// patterns.
+func NewEventFilter(include, exclude []string) (*EventFilter, error) {
+	f := &EventFilter{}
+	var err error
+	if f.include, err = compileEventPatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileEventPatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Match returns true when the event passes the filter. A nil filter passes
+// all events.
+func (f *EventFilter) Match(event string) bool {
+	if f == nil {
+		return true
+	}
+	if f.include != nil && !f.include.MatchString(event) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(event) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"testing"
+)
+
+func TestEventFilter(t *testing.T) {
+	testcases := []struct {
+		include []string
+		exclude []string
+		event   string
+		match   bool
+	}{
+		{nil, nil, "netdev_sent", true},
+		{[]string{"netdev_.*"}, nil, "netdev_sent", true},
+		{[]string{"netdev_.*"}, nil, "upcall_flow_limit_hit", false},
+		{[]string{"netdev"}, nil, "netdev_sent", false},
+		{[]string{"netdev_.*", "upcall_.*"}, nil, "upcall_flow_limit_hit", true},
+		{nil, []string{"poll_.*"}, "poll_create_node", false},
+		{nil, []string{"poll_.*"}, "netdev_sent", true},
+		{[]string{"netdev_.*"}, []string{"netdev_get_stats"}, "netdev_get_stats", false},
+	}
+	for i, tc := range testcases {
+		f, err := NewEventFilter(tc.include, tc.exclude)
+		if err != nil {
+			t.Fatalf("test %d: expected no error, but got %q", i, err)
+		}
+		if f.Match(tc.event) != tc.match {
+			t.Errorf("test %d: expected %s to match=%t", i, tc.event, tc.match)
+		}
+	}
+
+	if _, err := NewEventFilter([]string{"netdev_("}, nil); err == nil {
+		t.Fatalf("expected an error for an invalid pattern")
+	}
+	var f *EventFilter
+	if !f.Match("netdev_sent") {
+		t.Fatalf("expected a nil filter to match all events")
+	}
+}
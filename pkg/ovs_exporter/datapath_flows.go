@@ -0,0 +1,384 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// OVS Datapath: Flow breakdown from dpctl/dump-flows
+	dpFlowsByInPort = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dp_flows_by_in_port"),
+		"The number of flows in a datapath by the input port the flows match on.",
+		[]string{"system_id", "datapath", "in_port"}, nil,
+	)
+	dpFlowsByAction = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dp_flows_by_action"),
+		"The number of flows in a datapath by the class of actions they execute. The values of action are: drop, ct, recirc, output, userspace. A flow with several actions counts towards each of them.",
+		[]string{"system_id", "datapath", "action"}, nil,
+	)
+	dpFlowsByOffload = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dp_flows_by_offload"),
+		"The number of flows in a datapath by hardware offload state. The values of offloaded are: yes, partial, no, other.",
+		[]string{"system_id", "datapath", "offloaded"}, nil,
+	)
+	dpFlowIdleSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dp_flow_idle_seconds"),
+		"The time since flows in a datapath were last used. Flows that were never used are not observed.",
+		[]string{"system_id", "datapath"}, nil,
+	)
+	dpFlowAgeSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dp_flow_age_seconds"),
+		"The time since flows in a datapath were first seen by the exporter. The resolution is the poll interval.",
+		[]string{"system_id", "datapath"}, nil,
+	)
+	dpFlowsDumpTruncated = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dp_flows_dump_truncated"),
+		"Whether the flow breakdown of a datapath is incomplete (1), because the datapath has more flows than the configured limit, or not (0).",
+		[]string{"system_id", "datapath"}, nil,
+	)
+)
+
+var (
+	dpFlowActions = []string{"drop", "ct", "recirc", "output", "userspace"}
+
+	dpFlowIdleBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60}
+	dpFlowAgeBuckets  = []float64{1, 5, 15, 30, 60, 300, 600, 1800, 3600}
+)
+
+// DatapathFlow is a single flow from the output of `ovs-appctl
+// dpctl/dump-flows -m`.
+type DatapathFlow struct {
+	UFID      string
+	InPort    string
+	Packets   float64
+	Bytes     float64
+	Used      float64 // seconds since last use, -1 if never used
+	Offloaded string
+	Layer     string
+	Actions   []string
+}
+
+// splitTopLevel splits s on sep, ignoring separators inside parentheses.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// classifyDatapathActions maps the actions of a datapath flow to the
+// action classes in dpFlowActions. Each class is reported at most once.
+func classifyDatapathActions(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "drop" || strings.HasPrefix(s, "drop(") {
+		return []string{"drop"}
+	}
+	seen := map[string]bool{}
+	classes := []string{}
+	for _, action := range splitTopLevel(s, ',') {
+		action = strings.TrimSpace(action)
+		var class string
+		switch {
+		case action == "":
+			continue
+		case action == "drop" || strings.HasPrefix(action, "drop("):
+			class = "drop"
+		case action == "ct" || strings.HasPrefix(action, "ct("):
+			class = "ct"
+		case strings.HasPrefix(action, "recirc("):
+			class = "recirc"
+		case strings.HasPrefix(action, "userspace("):
+			class = "userspace"
+		case strings.HasPrefix(action, "output("):
+			class = "output"
+		case !strings.ContainsAny(action, "()=:"):
+			// A bare port number or, with names, a bare port name.
+			class = "output"
+		default:
+			continue
+		}
+		if !seen[class] {
+			seen[class] = true
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// parseDatapathFlow parses a single line of `ovs-appctl dpctl/dump-flows -m`,
+// e.g. "ufid:..., recirc_id(0),in_port(2),..., packets:10, bytes:980,
+// used:0.532s, offloaded:yes, dp:tc, actions:3".
+func parseDatapathFlow(line string) (*DatapathFlow, bool) {
+	line = strings.TrimSpace(line)
+	i := strings.LastIndex(line, "actions:")
+	if i < 0 {
+		return nil, false
+	}
+	f := &DatapathFlow{
+		Used:      -1,
+		Offloaded: "no",
+		Actions:   classifyDatapathActions(line[i+len("actions:"):]),
+	}
+	for _, field := range splitTopLevel(strings.TrimRight(line[:i], ", "), ',') {
+		field = strings.TrimSpace(field)
+		switch {
+		case strings.HasPrefix(field, "ufid:"):
+			f.UFID = strings.TrimPrefix(field, "ufid:")
+		case strings.HasPrefix(field, "in_port("):
+			f.InPort = strings.TrimSuffix(strings.TrimPrefix(field, "in_port("), ")")
+		case strings.HasPrefix(field, "packets:"):
+			if v, err := parseCounter(strings.TrimPrefix(field, "packets:")); err == nil {
+				f.Packets = v
+			}
+		case strings.HasPrefix(field, "bytes:"):
+			if v, err := parseCounter(strings.TrimPrefix(field, "bytes:")); err == nil {
+				f.Bytes = v
+			}
+		case strings.HasPrefix(field, "used:"):
+			if v, err := parseCounter(strings.TrimSuffix(strings.TrimPrefix(field, "used:"), "s")); err == nil {
+				f.Used = v
+			}
+		case strings.HasPrefix(field, "offloaded:"):
+			f.Offloaded = strings.TrimPrefix(field, "offloaded:")
+		case strings.HasPrefix(field, "dp:"):
+			f.Layer = strings.TrimPrefix(field, "dp:")
+		}
+	}
+	if i := strings.Index(f.InPort, "/"); i > 0 {
+		// Masked match, e.g. in_port(2/0xffffffff) with -m
+		f.InPort = f.InPort[:i]
+	}
+	return f, true
+}
+
+// parseDatapathFlows parses the output of `ovs-appctl dpctl/dump-flows -m`.
+// It stops after limit flows, if limit is positive, and reports whether the
+// output was truncated. Output which is not valid UTF-8 is rejected, because
+// the input ports become label values.
+func parseDatapathFlows(s string, limit int) ([]*DatapathFlow, bool, error) {
+	flows := []*DatapathFlow{}
+	if !utf8.ValidString(s) {
+		return flows, false, fmt.Errorf("the 'dpctl/dump-flows' command return invalid UTF-8")
+	}
+	for _, line := range strings.Split(s, "\n") {
+		f, ok := parseDatapathFlow(line)
+		if !ok {
+			// e.g. "flow-dump from pmd on cpu core: 3"
+			continue
+		}
+		if limit > 0 && len(flows) >= limit {
+			return flows, true, nil
+		}
+		flows = append(flows, f)
+	}
+	return flows, false, nil
+}
+
+// GetAppDatapathFlows returns the flows of a datapath from
+// `ovs-appctl dpctl/dump-flows -m`. It returns at most limit flows, if limit
+// is positive, and reports whether there were more.
+func (c *ovsClient) GetAppDatapathFlows(component string, datapath string, limit int) ([]*DatapathFlow, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	output, err := c.appctl(component, "dpctl/dump-flows", "-m", datapath)
+	if err != nil {
+		return nil, false, err
+	}
+	return parseDatapathFlows(output, limit)
+}
+
+// newConstHistogram builds a histogram metric from raw observations.
+func newConstHistogram(desc *prometheus.Desc, buckets []float64, values []float64, labels ...string) prometheus.Metric {
+	counts := make(map[float64]uint64, len(buckets))
+	var sum float64
+	for _, v := range values {
+		sum += v
+		for _, b := range buckets {
+			if v <= b {
+				counts[b]++
+			}
+		}
+	}
+	return prometheus.MustNewConstHistogram(desc, uint64(len(values)), sum, counts, labels...)
+}
+
+// gatherDatapathFlows dumps the flows of the datapaths reported by dpif/show
+// and aggregates them by input port, action class and offload state. It
+// returns the offload states of the datapaths whose flows were dumped
+// completely, for the hardware offload collector.
+func (e *Exporter) gatherDatapathFlows(dps []*Datapath) map[string]map[string]int {
+	now := time.Now()
+	dumped := make(map[string]map[string]int, len(dps))
+	if e.dpFlowFirstSeen == nil {
+		e.dpFlowFirstSeen = make(map[string]map[string]time.Time)
+	}
+	for _, dp := range dps {
+		truncated := 0.0
+		if e.dpFlowsLimit > 0 && dp.Flows > float64(e.dpFlowsLimit) {
+			e.logger.Debug("gatherDatapathFlows() skips datapath over flow limit",
+				"datapath", dp.Name,
+				"flows", dp.Flows,
+				"limit", e.dpFlowsLimit,
+			)
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				dpFlowsDumpTruncated,
+				prometheus.GaugeValue,
+				1,
+				e.system.ID,
+				dp.Name,
+			))
+			// The flows are not tracked while the datapath is skipped, so
+			// their first-seen times would be stale once it is dumped again.
+			delete(e.dpFlowFirstSeen, dp.Name)
+			continue
+		}
+
+		e.logger.Debug("GatherMetrics() calls GetAppDatapathFlows()", "datapath", dp.Name)
+		flows, isTruncated, err := e.client.GetAppDatapathFlows("vswitchd-service", dp.Name, e.dpFlowsLimit)
+		if err != nil {
+			e.logger.Error("GetAppDatapathFlows() failed", "datapath", dp.Name, "error", err.Error())
+			e.collectorFailed("dp_flows", dp.Name, err)
+			continue
+		}
+		if isTruncated {
+			truncated = 1
+		}
+
+		byInPort := make(map[string]int)
+		byAction := make(map[string]int)
+		byOffload := map[string]int{"yes": 0, "partial": 0, "no": 0}
+		idle := []float64{}
+		ages := []float64{}
+		firstSeen := make(map[string]time.Time, len(flows))
+		for _, f := range flows {
+			if f.InPort != "" {
+				byInPort[f.InPort]++
+			}
+			for _, action := range f.Actions {
+				byAction[action]++
+			}
+			if _, known := byOffload[f.Offloaded]; known {
+				byOffload[f.Offloaded]++
+			} else {
+				byOffload["other"]++
+			}
+			if f.Used >= 0 {
+				idle = append(idle, f.Used)
+			}
+			if f.UFID == "" {
+				continue
+			}
+			seen, exists := e.dpFlowFirstSeen[dp.Name][f.UFID]
+			if !exists {
+				seen = now
+			}
+			firstSeen[f.UFID] = seen
+			ages = append(ages, now.Sub(seen).Seconds())
+		}
+		// Flows absent from the current dump are forgotten.
+		e.dpFlowFirstSeen[dp.Name] = firstSeen
+
+		for inPort, count := range byInPort {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				dpFlowsByInPort,
+				prometheus.GaugeValue,
+				float64(count),
+				e.system.ID,
+				dp.Name,
+				inPort,
+			))
+		}
+		for _, action := range dpFlowActions {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				dpFlowsByAction,
+				prometheus.GaugeValue,
+				float64(byAction[action]),
+				e.system.ID,
+				dp.Name,
+				action,
+			))
+		}
+		for offloaded, count := range byOffload {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				dpFlowsByOffload,
+				prometheus.GaugeValue,
+				float64(count),
+				e.system.ID,
+				dp.Name,
+				offloaded,
+			))
+		}
+		e.metrics = append(e.metrics, newConstHistogram(
+			dpFlowIdleSeconds,
+			dpFlowIdleBuckets,
+			idle,
+			e.system.ID,
+			dp.Name,
+		))
+		e.metrics = append(e.metrics, newConstHistogram(
+			dpFlowAgeSeconds,
+			dpFlowAgeBuckets,
+			ages,
+			e.system.ID,
+			dp.Name,
+		))
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			dpFlowsDumpTruncated,
+			prometheus.GaugeValue,
+			truncated,
+			e.system.ID,
+			dp.Name,
+		))
+		if !isTruncated {
+			dumped[dp.Name] = byOffload
+		}
+		e.logger.Debug("GatherMetrics() completed dpctl/dump-flows", "datapath", dp.Name, "flows", len(flows))
+	}
+	for name := range e.dpFlowFirstSeen {
+		found := false
+		for _, dp := range dps {
+			if dp.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(e.dpFlowFirstSeen, name)
+		}
+	}
+	return dumped
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testDatapathFlows = `ufid:1b2c3d4e-0000-0000-0000-000000000001, recirc_id(0),dp_hash(0/0),skb_priority(0/0),in_port(2),skb_mark(0/0),ct_state(0/0),eth(src=fa:16:3e:00:00:01,dst=fa:16:3e:00:00:02),eth_type(0x0800),ipv4(src=10.0.0.1,dst=10.0.0.2,proto=6,frag=no), packets:10, bytes:980, used:0.532s, flags:SP., actions:ct(zone=5),recirc(0x1)
+ufid:1b2c3d4e-0000-0000-0000-000000000002, recirc_id(0x1),in_port(2),eth_type(0x0800),ipv4(frag=no), packets:0, bytes:0, used:never, offloaded:yes, dp:tc, actions:3,userspace(pid=3456,slow_path(action))
+ufid:1b2c3d4e-0000-0000-0000-000000000003, recirc_id(0),in_port(3),eth_type(0x86dd),ipv6(frag=no), packets:1, bytes:90, used:2.1s, actions:drop
+`
+
+func TestParseDatapathFlows(t *testing.T) {
+	flows, truncated, err := parseDatapathFlows(testDatapathFlows, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated {
+		t.Fatalf("expected output not to be truncated")
+	}
+	if len(flows) != 3 {
+		t.Fatalf("expected 3 flows, but got %d", len(flows))
+	}
+
+	expected := []DatapathFlow{
+		{
+			UFID:      "1b2c3d4e-0000-0000-0000-000000000001",
+			InPort:    "2",
+			Packets:   10,
+			Bytes:     980,
+			Used:      0.532,
+			Offloaded: "no",
+			Actions:   []string{"ct", "recirc"},
+		},
+		{
+			UFID:      "1b2c3d4e-0000-0000-0000-000000000002",
+			InPort:    "2",
+			Used:      -1,
+			Offloaded: "yes",
+			Layer:     "tc",
+			Actions:   []string{"output", "userspace"},
+		},
+		{
+			UFID:      "1b2c3d4e-0000-0000-0000-000000000003",
+			InPort:    "3",
+			Packets:   1,
+			Bytes:     90,
+			Used:      2.1,
+			Offloaded: "no",
+			Actions:   []string{"drop"},
+		},
+	}
+	for i, f := range flows {
+		if !reflect.DeepEqual(*f, expected[i]) {
+			t.Errorf("flow %d: expected %+v, but got %+v", i, expected[i], *f)
+		}
+	}
+
+	flows, truncated, _ = parseDatapathFlows(testDatapathFlows, 2)
+	if !truncated || len(flows) != 2 {
+		t.Fatalf("expected 2 flows and truncated output, but got %d flows and truncated=%t", len(flows), truncated)
+	}
+
+	if _, _, err := parseDatapathFlows("ufid:1, in_port(\xff), packets:1, bytes:1, used:never, actions:drop", 0); err == nil {
+		t.Fatalf("expected output with invalid UTF-8 to be rejected")
+	}
+}
+
+func TestGatherDatapathFlows(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	fake.setReply("ovs-vswitchd", "dpctl/dump-flows", strings.Replace(testDatapathFlows, "used:2.1s,", "used:2.1s, offloaded:maybe,", 1))
+	logger, err := NewLoggerWithWriter("error", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(WithClientConfig(fake.config()), WithTimeout(2), WithLogger(logger), WithDatapathFlows(5))
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+	// Collect serves the metrics gathered below instead of polling.
+	exporter.nextCollectionTicker = time.Now().Add(time.Hour).Unix()
+
+	dp := &Datapath{Name: "system@ovs-system", Flows: 3}
+	exporter.gatherDatapathFlows([]*Datapath{dp})
+	expected := `
+# HELP ovs_dp_flows_by_offload The number of flows in a datapath by hardware offload state. The values of offloaded are: yes, partial, no, other.
+# TYPE ovs_dp_flows_by_offload gauge
+ovs_dp_flows_by_offload{datapath="system@ovs-system",offloaded="no",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_dp_flows_by_offload{datapath="system@ovs-system",offloaded="other",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+ovs_dp_flows_by_offload{datapath="system@ovs-system",offloaded="partial",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 0
+ovs_dp_flows_by_offload{datapath="system@ovs-system",offloaded="yes",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "ovs_dp_flows_by_offload"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The datapath grows over the limit and is skipped for a while. Its
+	// flows are forgotten, rather than aged from their old first-seen times
+	// once it is dumped again.
+	exporter.dpFlowFirstSeen[dp.Name]["1b2c3d4e-0000-0000-0000-000000000001"] = time.Now().Add(-time.Hour)
+	dp.Flows = 10
+	exporter.gatherDatapathFlows([]*Datapath{dp})
+	if _, exists := exporter.dpFlowFirstSeen[dp.Name]; exists {
+		t.Fatalf("expected the flows of a skipped datapath to be forgotten")
+	}
+	dp.Flows = 3
+	exporter.gatherDatapathFlows([]*Datapath{dp})
+	for ufid, seen := range exporter.dpFlowFirstSeen[dp.Name] {
+		if time.Since(seen) > time.Minute {
+			t.Fatalf("expected flow %s to be first seen now, but got %s", ufid, seen)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// OVS Datapath: Drop reasons derived from coverage counters
+	datapathDrops = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "datapath_drops_total"),
+		"The total number of packets dropped by OVS by drop reason. It is derived from the datapath_drop_* and drop_action_* coverage counters of ovs-vswitchd, and from the drop statistics of the interfaces of the userspace datapath.",
+		[]string{"system_id", "reason"}, nil,
+	)
+)
+
+// datapathDropReasonOther is the reason for drop counters that are not in
+// datapathDropReasons, e.g. counters added by a newer OVS release.
+const datapathDropReasonOther = "other"
+
+// datapathDropReasons maps the drop related coverage counters of
+// ovs-vswitchd to a stable set of reasons. The set must only grow, because
+// alerting rules depend on the values of the reason label.
+//
+// Reference: lib/dpif-netdev.c, lib/odp-execute.c, ofproto/ofproto-dpif-xlate.c
+var datapathDropReasons = map[string]string{
+	// Userspace datapath
+	"datapath_drop_meter":                  "meter",
+	"datapath_drop_userspace_action_error": "userspace_action_error",
+	"datapath_drop_tunnel_push_error":      "tunnel_push_error",
+	"datapath_drop_tunnel_pop_error":       "tunnel_pop_error",
+	"datapath_drop_recirc_error":           "recirc_error",
+	"datapath_drop_invalid_port":           "invalid_port",
+	"datapath_drop_invalid_bond":           "invalid_bond",
+	"datapath_drop_invalid_tnl_port":       "invalid_tunnel_port",
+	"datapath_drop_rx_invalid_packet":      "rx_invalid_packet",
+	"datapath_drop_hw_miss_recover":        "hw_miss_recover",
+	"datapath_drop_sample_error":           "sample_error",
+	"datapath_drop_nsh_decap_error":        "nsh_decap_error",
+	"datapath_drop_upcall_error":           "upcall_error",
+	"datapath_drop_lock_error":             "lock_error",
+	// Explicit drop actions installed by the OpenFlow translation
+	"drop_action_of_pipeline":               "of_pipeline",
+	"drop_action_bridge_not_found":          "bridge_not_found",
+	"drop_action_recursion_too_deep":        "recursion_too_deep",
+	"drop_action_too_many_resubmit":         "too_many_resubmit",
+	"drop_action_stack_too_deep":            "stack_too_deep",
+	"drop_action_no_recirculation_context":  "no_recirculation_context",
+	"drop_action_recirculation_conflict":    "recirculation_conflict",
+	"drop_action_too_many_mpls_labels":      "too_many_mpls_labels",
+	"drop_action_invalid_tunnel_metadata":   "invalid_tunnel_metadata",
+	"drop_action_unsupported_packet_type":   "unsupported_packet_type",
+	"drop_action_congestion":                "congestion",
+	"drop_action_forwarding_disabled":       "forwarding_disabled",
+	"drop_action_tunnel_routing_failed":     "tunnel_routing_failed",
+	"drop_action_tunnel_output_no_ethernet": "tunnel_output_no_ethernet",
+	"drop_action_tunnel_neigh_cache_miss":   "tunnel_neigh_cache_miss",
+}
+
+// datapathInterfaceDropReasons maps the drop statistics of the interfaces
+// of the userspace datapath, which netdev-dpdk reports in the statistics
+// column of the Interface table, to reasons. Like datapathDropReasons, the
+// set must only grow.
+//
+// The packets lost by failed upcalls, i.e. "miss with failed upcall" of
+// dpif-netdev/pmd-stats-show, are not added here, because the userspace
+// datapath counts them in datapath_drop_upcall_error already.
+//
+// Reference: lib/netdev-dpdk.c, Documentation/topics/dpdk/bridge.rst
+var datapathInterfaceDropReasons = map[string]string{
+	"ovs_rx_qos_drops":          "rx_qos",
+	"ovs_tx_qos_drops":          "tx_qos",
+	"ovs_tx_failure_drops":      "tx_failure",
+	"ovs_tx_mtu_exceeded_drops": "tx_mtu_exceeded",
+	"ovs_tx_invalid_hwol_drops": "tx_invalid_hwol",
+}
+
+// isDatapathDropEvent returns true when a coverage event counts dropped
+// packets.
+func isDatapathDropEvent(event string) bool {
+	return strings.HasPrefix(event, "datapath_drop_") || strings.HasPrefix(event, "drop_action_")
+}
+
+// getDatapathDrops aggregates the totals of drop related coverage counters
+// by reason. Every known reason is present in the result, because OVS omits
+// the counters that were never hit from coverage/show.
+func getDatapathDrops(coverage map[string]map[string]float64) map[string]float64 {
+	drops := make(map[string]float64, len(datapathDropReasons)+1)
+	for _, reason := range datapathDropReasons {
+		drops[reason] = 0
+	}
+	drops[datapathDropReasonOther] = 0
+	for event, metric := range coverage {
+		if !isDatapathDropEvent(event) {
+			continue
+		}
+		total, exists := metric["total"]
+		if !exists {
+			continue
+		}
+		reason, known := datapathDropReasons[event]
+		if !known {
+			reason = datapathDropReasonOther
+		}
+		drops[reason] += total
+	}
+	return drops
+}
+
+// getInterfaceDrops sums up the drop statistics of the interfaces of the
+// userspace datapath by reason. Every known reason is present in the
+// result, because only DPDK and vhost-user interfaces report them.
+func getInterfaceDrops(intfs []*Interface) map[string]float64 {
+	drops := make(map[string]float64, len(datapathInterfaceDropReasons))
+	for _, reason := range datapathInterfaceDropReasons {
+		drops[reason] = 0
+	}
+	for _, intf := range intfs {
+		for key, value := range intf.Statistics {
+			if reason, exists := datapathInterfaceDropReasons[key]; exists {
+				drops[reason] += float64(value)
+			}
+		}
+	}
+	return drops
+}
+
+// gatherInterfaceDrops exports the drop statistics of the interfaces of the
+// userspace datapath.
+func (e *Exporter) gatherInterfaceDrops(intfs []*Interface) {
+	for reason, value := range getInterfaceDrops(intfs) {
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			datapathDrops,
+			prometheus.CounterValue,
+			value,
+			e.system.ID,
+			reason,
+		))
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"testing"
+)
+
+func TestGetDatapathDrops(t *testing.T) {
+	coverage := map[string]map[string]float64{
+		"drop_action_of_pipeline":        {"5s": 0.2, "5m": 0.1, "1h": 0.0, "total": 42},
+		"datapath_drop_upcall_error":     {"total": 7},
+		"datapath_drop_something_new":    {"total": 3},
+		"drop_action_something_else":     {"total": 2},
+		"netdev_sent":                    {"total": 1000},
+		"datapath_drop_invalid_tnl_port": {"5s": 0.0},
+	}
+	drops := getDatapathDrops(coverage)
+
+	if len(drops) != len(datapathDropReasons)+1 {
+		t.Fatalf("expected %d reasons, but got %d", len(datapathDropReasons)+1, len(drops))
+	}
+	expected := map[string]float64{
+		"of_pipeline":         42,
+		"upcall_error":        7,
+		"invalid_tunnel_port": 0,
+		"congestion":          0,
+		"other":               5,
+	}
+	for reason, value := range expected {
+		if drops[reason] != value {
+			t.Errorf("reason %s: expected %v, but got %v", reason, value, drops[reason])
+		}
+	}
+}
+
+func TestGetInterfaceDrops(t *testing.T) {
+	intfs := []*Interface{
+		{Name: "dpdk0", Statistics: map[string]int{"ovs_tx_failure_drops": 3, "ovs_rx_qos_drops": 1, "rx_dropped": 100}},
+		{Name: "vhu0", Statistics: map[string]int{"ovs_tx_failure_drops": 4, "ovs_tx_retries": 9}},
+		{Name: "tap0", Statistics: map[string]int{"rx_packets": 5}},
+	}
+	drops := getInterfaceDrops(intfs)
+	if len(drops) != len(datapathInterfaceDropReasons) {
+		t.Fatalf("expected %d reasons, but got %d", len(datapathInterfaceDropReasons), len(drops))
+	}
+	expected := map[string]float64{
+		"tx_failure":      7,
+		"rx_qos":          1,
+		"tx_qos":          0,
+		"tx_mtu_exceeded": 0,
+		"tx_invalid_hwol": 0,
+	}
+	for reason, value := range expected {
+		if drops[reason] != value {
+			t.Errorf("reason %s: expected %v, but got %v", reason, value, drops[reason])
+		}
+	}
+	// The reasons must not collide with those of the coverage counters, as
+	// both are exported in ovs_datapath_drops_total.
+	for _, reason := range datapathDropReasons {
+		if _, exists := drops[reason]; exists || reason == datapathDropReasonOther {
+			t.Errorf("reason %s is derived from both coverage counters and interface statistics", reason)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDaemons are the OVS daemons whose control sockets are faked.
+var fakeDaemons = []string{"ovsdb-server", "ovs-vswitchd", "ovn-controller"}
+
+// fakeOVS serves the OVSDB JSON-RPC protocol of ovsdb-server and the
+// unixctl protocol of ovsdb-server, ovs-vswitchd and ovn-controller on unix
+// sockets in a temporary run directory, so that the collectors can be
+// tested without OVS.
+//
+// The database rows and the replies to ovs-appctl commands are loaded from
+// testdata/ovs/<fixture>: ovsdb.json holds the rows per table and
+// <daemon>/<command>.txt the reply to a command, with the slashes of the
+// command replaced by underscores, e.g. ovs-vswitchd/dpif_show.txt.
+type fakeOVS struct {
+	sync.Mutex
+	t         testing.TB
+	dir       string
+	systemID  string
+	schema    json.RawMessage
+	types     map[string]map[string]interface{}
+	tables    map[string][]map[string]interface{}
+	replies   map[string]map[string]string
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	wg        sync.WaitGroup
+}
+
+type fakeRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     interface{}     `json:"id"`
+}
+
+type fakeResponse struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+// newFakeOVS starts a fake OVS serving the given fixture. It is stopped
+// when the test ends.
+func newFakeOVS(t testing.TB, fixture string) *fakeOVS {
+	t.Helper()
+	// The run directory is not created with t.TempDir(), because unix
+	// socket paths are limited to 108 bytes.
+	dir, err := os.MkdirTemp("", "ovs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeOVS{
+		t:       t,
+		dir:     dir,
+		types:   make(map[string]map[string]interface{}),
+		tables:  make(map[string][]map[string]interface{}),
+		replies: make(map[string]map[string]string),
+		conns:   make(map[net.Conn]bool),
+	}
+	t.Cleanup(f.close)
+
+	f.loadSchema(filepath.Join("testdata", "vswitch.ovsschema"))
+	f.loadFixture(filepath.Join("testdata", "ovs", fixture))
+
+	pid := strconv.Itoa(os.Getpid())
+	f.writeFile("system-id.conf", f.systemID+"\n")
+	for _, daemon := range fakeDaemons {
+		f.writeFile(daemon+".pid", pid+"\n")
+		f.writeFile(daemon+".log", "")
+		f.listen(daemon+"."+pid+".ctl", f.serveAppctl(daemon))
+	}
+	f.listen("db.sock", f.serveOvsdb)
+	return f
+}
+
+func (f *fakeOVS) loadSchema(path string) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	var schema struct {
+		Tables map[string]struct {
+			Columns map[string]struct {
+				Type interface{} `json:"type"`
+			} `json:"columns"`
+		} `json:"tables"`
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		f.t.Fatalf("failed decoding %s: %s", path, err)
+	}
+	f.schema = b
+	for table, t := range schema.Tables {
+		f.types[table] = make(map[string]interface{})
+		for column, c := range t.Columns {
+			f.types[table][column] = c.Type
+		}
+	}
+}
+
+func (f *fakeOVS) loadFixture(dir string) {
+	b, err := os.ReadFile(filepath.Join(dir, "ovsdb.json"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	tables := make(map[string][]map[string]interface{})
+	if err := json.Unmarshal(b, &tables); err != nil {
+		f.t.Fatalf("failed decoding %s: %s", filepath.Join(dir, "ovsdb.json"), err)
+	}
+	for table, rows := range tables {
+		f.setRows(table, rows)
+	}
+
+	for _, daemon := range fakeDaemons {
+		f.replies[daemon] = make(map[string]string)
+		files, err := os.ReadDir(filepath.Join(dir, daemon))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			b, err := os.ReadFile(filepath.Join(dir, daemon, file.Name()))
+			if err != nil {
+				f.t.Fatal(err)
+			}
+			cmd := strings.ReplaceAll(strings.TrimSuffix(file.Name(), ".txt"), "_", "/")
+			f.replies[daemon][cmd] = string(b)
+		}
+	}
+}
+
+// setRows replaces the rows of a table. Columns missing from a row are set
+// to the empty value of their type, as ovsdb-server returns all columns.
+// The rundir of the Open_vSwitch table is set to the run directory.
+func (f *fakeOVS) setRows(table string, rows []map[string]interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	types, exists := f.types[table]
+	if !exists {
+		f.t.Fatalf("table %s is not in the schema", table)
+	}
+	for i, row := range rows {
+		for column, columnType := range types {
+			if _, exists := row[column]; !exists {
+				row[column] = fakeEmptyValue(columnType)
+			}
+		}
+		if _, exists := row["_uuid"]; !exists {
+			row["_uuid"] = []interface{}{"uuid", fmt.Sprintf("00000000-0000-0000-0000-%012d", i)}
+		}
+		row["_version"] = []interface{}{"uuid", "00000000-0000-0000-0000-000000000000"}
+		if table == "Open_vSwitch" {
+			externalIDs := fakeMap(row["external_ids"])
+			if externalIDs["rundir"] == "" {
+				externalIDs["rundir"] = f.dir
+			}
+			f.systemID = externalIDs["system-id"]
+			keys := make([]string, 0, len(externalIDs))
+			for k := range externalIDs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			pairs := []interface{}{}
+			for _, k := range keys {
+				pairs = append(pairs, []interface{}{k, externalIDs[k]})
+			}
+			row["external_ids"] = []interface{}{"map", pairs}
+		}
+	}
+	f.tables[table] = rows
+}
+
+// setReply sets the reply of a daemon to a command. The command may
+// include arguments, e.g. "dpctl/dump-flows type=offloaded system@ovs-system",
+// which take precedence over the reply to the command without arguments.
+func (f *fakeOVS) setReply(daemon string, cmd string, reply string) {
+	f.Lock()
+	defer f.Unlock()
+	f.replies[daemon][cmd] = reply
+}
+
+// config returns the configuration pointing the exporter at the sockets
+// and files of the fake.
+func (f *fakeOVS) config() ClientConfig {
+	return ClientConfig{
+		RunDir:               f.dir,
+		RunDirOvn:            f.dir,
+		DatabaseName:         "Open_vSwitch",
+		DatabaseRemote:       "unix:" + filepath.Join(f.dir, "db.sock"),
+		DatabaseFile:         filepath.Join(f.dir, "conf.db"),
+		DatabaseLogFile:      filepath.Join(f.dir, "ovsdb-server.log"),
+		DatabasePidFile:      filepath.Join(f.dir, "ovsdb-server.pid"),
+		SystemIDFile:         filepath.Join(f.dir, "system-id.conf"),
+		VswitchdLogFile:      filepath.Join(f.dir, "ovs-vswitchd.log"),
+		VswitchdPidFile:      filepath.Join(f.dir, "ovs-vswitchd.pid"),
+		OvnControllerLogFile: filepath.Join(f.dir, "ovn-controller.log"),
+		OvnControllerPidFile: filepath.Join(f.dir, "ovn-controller.pid"),
+	}
+}
+
+func (f *fakeOVS) writeFile(name string, data string) {
+	if err := os.WriteFile(filepath.Join(f.dir, name), []byte(data), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fakeOVS) listen(name string, handle func(fakeRequest) fakeResponse) {
+	l, err := net.Listen("unix", filepath.Join(f.dir, name))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.listeners = append(f.listeners, l)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			f.Lock()
+			f.conns[conn] = true
+			f.Unlock()
+			f.wg.Add(1)
+			go func() {
+				defer f.wg.Done()
+				f.serve(conn, handle)
+				f.Lock()
+				delete(f.conns, conn)
+				f.Unlock()
+			}()
+		}
+	}()
+}
+
+// serve answers the JSON-RPC requests of a connection until it is closed.
+func (f *fakeOVS) serve(conn net.Conn, handle func(fakeRequest) fakeResponse) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	enc.SetEscapeHTML(false)
+	for {
+		var req fakeRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		resp := handle(req)
+		resp.ID = req.ID
+		if err := enc.Encode(&resp); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeOVS) close() {
+	for _, l := range f.listeners {
+		l.Close()
+	}
+	f.Lock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.Unlock()
+	f.wg.Wait()
+	os.RemoveAll(f.dir)
+}
+
+// serveOvsdb answers the requests the exporter sends to ovsdb-server. The
+// where clauses of select operations are ignored.
+func (f *fakeOVS) serveOvsdb(req fakeRequest) fakeResponse {
+	switch req.Method {
+	case "echo":
+		var params interface{}
+		json.Unmarshal(req.Params, &params)
+		return fakeResponse{Result: params}
+	case "list_dbs":
+		return fakeResponse{Result: []string{"Open_vSwitch"}}
+	case "get_schema":
+		return fakeResponse{Result: f.schema}
+	case "transact":
+		var params []json.RawMessage
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) < 1 {
+			return fakeResponse{Error: "syntax error"}
+		}
+		results := []interface{}{}
+		for _, param := range params[1:] {
+			var op struct {
+				Op      string   `json:"op"`
+				Table   string   `json:"table"`
+				Columns []string `json:"columns"`
+			}
+			if err := json.Unmarshal(param, &op); err != nil {
+				return fakeResponse{Error: "syntax error"}
+			}
+			if op.Op != "select" {
+				return fakeResponse{Error: fmt.Sprintf("unsupported operation %s", op.Op)}
+			}
+			results = append(results, map[string]interface{}{"rows": f.selectRows(op.Table, op.Columns)})
+		}
+		return fakeResponse{Result: results}
+	}
+	return fakeResponse{Error: fmt.Sprintf("unknown method %s", req.Method)}
+}
+
+func (f *fakeOVS) selectRows(table string, columns []string) []map[string]interface{} {
+	f.Lock()
+	defer f.Unlock()
+	rows := []map[string]interface{}{}
+	for _, row := range f.tables[table] {
+		if len(columns) == 0 {
+			rows = append(rows, row)
+			continue
+		}
+		selected := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			if value, exists := row[column]; exists {
+				selected[column] = value
+			}
+		}
+		rows = append(rows, selected)
+	}
+	return rows
+}
+
+// serveAppctl returns a handler answering ovs-appctl commands on behalf of
+// a daemon.
+func (f *fakeOVS) serveAppctl(daemon string) func(fakeRequest) fakeResponse {
+	return func(req fakeRequest) fakeResponse {
+		var args []string
+		json.Unmarshal(req.Params, &args)
+		f.Lock()
+		defer f.Unlock()
+		if reply, exists := f.replies[daemon][strings.Join(append([]string{req.Method}, args...), " ")]; exists {
+			return fakeResponse{Result: reply}
+		}
+		if reply, exists := f.replies[daemon][req.Method]; exists {
+			return fakeResponse{Result: reply}
+		}
+		return fakeResponse{Error: fmt.Sprintf("%q is not a valid command (use \"list-commands\" to see a list of valid commands)", req.Method)}
+	}
+}
+
+// fakeEmptyValue returns the value of an empty column of the given type in
+// the OVSDB wire format, e.g. ["set", []] for optional columns.
+func fakeEmptyValue(columnType interface{}) interface{} {
+	t, ok := columnType.(map[string]interface{})
+	if !ok {
+		return fakeEmptyAtom(columnType)
+	}
+	if _, exists := t["value"]; exists {
+		return []interface{}{"map", []interface{}{}}
+	}
+	min, max := 1.0, interface{}(1.0)
+	if v, exists := t["min"]; exists {
+		min = v.(float64)
+	}
+	if v, exists := t["max"]; exists {
+		max = v
+	}
+	if min == 0 || max != 1.0 {
+		return []interface{}{"set", []interface{}{}}
+	}
+	return fakeEmptyAtom(t["key"])
+}
+
+func fakeEmptyAtom(atomType interface{}) interface{} {
+	if t, ok := atomType.(map[string]interface{}); ok {
+		atomType = t["type"]
+	}
+	switch atomType {
+	case "integer", "real":
+		return 0
+	case "boolean":
+		return false
+	case "uuid":
+		return []interface{}{"uuid", "00000000-0000-0000-0000-000000000000"}
+	}
+	return ""
+}
+
+// fakeMap decodes a map in the OVSDB wire format.
+func fakeMap(value interface{}) map[string]string {
+	m := make(map[string]string)
+	v, ok := value.([]interface{})
+	if !ok || len(v) != 2 || v[0] != "map" {
+		return m
+	}
+	pairs, _ := v[1].([]interface{})
+	for _, pair := range pairs {
+		kv, ok := pair.([]interface{})
+		if !ok || len(kv) != 2 {
+			continue
+		}
+		k, _ := kv[0].(string)
+		s, _ := kv[1].(string)
+		m[k] = s
+	}
+	return m
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The fuzz targets are seeded with the outputs in testdata/ovs and with
+// malformed outputs. The outputs in testdata/ovs are synthetic, see
+// testdata/ovs/README.md, so the seeds do not cover the quirks of the real
+// output of any OVS release. Run e.g.
+// `go test -run '^$' -fuzz FuzzParseCoverage` to fuzz a parser.
+
+var fuzzDesc = prometheus.NewDesc("ovs_fuzz", "A metric built from parser output.", []string{"label"}, nil)
+
+// fuzzSeeds adds the outputs of a command in the fixtures in testdata/ovs,
+// e.g. ovs-vswitchd/dpif_show.txt, to the seed corpus.
+func fuzzSeeds(f *testing.F, name string, seeds ...string) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "ovs", "*", "*", name))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+}
+
+// checkFuzzMetric fails when a value and labels taken from parser output
+// cannot be exported, i.e. when prometheus.MustNewConstMetric would panic,
+// or when the value is not a finite, non-negative number.
+func checkFuzzMetric(t *testing.T, value float64, labels ...string) {
+	t.Helper()
+	if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		t.Fatalf("unexpected value %v for %q", value, labels)
+	}
+	for _, label := range labels {
+		if _, err := prometheus.NewConstMetric(fuzzDesc, prometheus.GaugeValue, value, label); err != nil {
+			t.Fatalf("unexpected label %q: %s", label, err)
+		}
+	}
+}
+
+func FuzzParseCoverage(f *testing.F) {
+	fuzzSeeds(f, "coverage_show.txt",
+		"netlink_sent  15.2/sec  NaN/sec  14.8694/sec   total: 81034\n",
+		"netlink_sent  15.2/sec  14.983/sec  14.8694/sec   total: -1\n",
+		"\xff\xfe  0.0/sec  0.0/sec  0.0/sec   total: 1\n",
+	)
+	f.Fuzz(func(t *testing.T, s string) {
+		metrics, err := parseCoverage(s)
+		if err != nil {
+			return
+		}
+		for event, values := range metrics {
+			for period, value := range values {
+				checkFuzzMetric(t, value, event, period)
+			}
+		}
+	})
+}
+
+func FuzzParseMemory(f *testing.F) {
+	fuzzSeeds(f, "memory_show.txt",
+		"handlers:Inf ports:7\n",
+		":1 a:b:c \xff:2\n",
+	)
+	f.Fuzz(func(t *testing.T, s string) {
+		metrics, err := parseMemory(s)
+		if err != nil {
+			return
+		}
+		for facility, value := range metrics {
+			checkFuzzMetric(t, value, facility)
+		}
+	})
+}
+
+func FuzzParseDpifShow(f *testing.F) {
+	fuzzSeeds(f, "dpif_show.txt",
+		"system@ovs-system\n  br-int:\n    br-int 65534/1: (internal)\n",
+		"system@ovs-system: hit:1\n  br-int:\n    tap0\n",
+		"system@ovs-system: hit:1\n  br-int:\n    tap0 NaN/Inf: (system)\n",
+		"a:\n b\n  c d/e: (f\n   g\n",
+	)
+	f.Fuzz(func(t *testing.T, s string) {
+		brs, intfs, err := parseDpifShow(s)
+		if err != nil {
+			return
+		}
+		for _, br := range brs {
+			checkFuzzMetric(t, 1, br.Name, br.DatapathName)
+		}
+		for _, intf := range intfs {
+			checkFuzzMetric(t, intf.OfPort, intf.Name, intf.BridgeName, intf.DatapathName, intf.Type)
+			checkFuzzMetric(t, intf.Index)
+		}
+	})
+}
+
+func FuzzParseDpctlShow(f *testing.F) {
+	fuzzSeeds(f, "dpctl_show.txt",
+		"system@ovs-system\n  lookups: hit:1\n",
+		"system@ovs-system:\n  lookups:\n  flows\n  masks: hit:NaN total:-1\n",
+		"  flows: 1\nsystem@ovs-system:\n  lookups: hit:1 bogus:2\n",
+	)
+	f.Fuzz(func(t *testing.T, s string) {
+		dps, err := parseDpctlShow(s)
+		if err != nil {
+			return
+		}
+		for _, dp := range dps {
+			checkFuzzMetric(t, dp.Flows, dp.Name)
+			checkFuzzMetric(t, dp.Lookups.Hit)
+			checkFuzzMetric(t, dp.Lookups.Missed)
+			checkFuzzMetric(t, dp.Lookups.Lost)
+			checkFuzzMetric(t, dp.Masks.Hit)
+			checkFuzzMetric(t, dp.Masks.Total)
+			checkFuzzMetric(t, dp.Masks.HitRatio)
+		}
+	})
+}
+
+func FuzzParseDatapathFlows(f *testing.F) {
+	fuzzSeeds(f, "dpctl_dump-flows.txt",
+		testDatapathFlows,
+		"in_port(2/0xffffffff), packets:NaN, bytes:-5, used:Infs, actions:drop\n",
+		"in_port(\xff), actions:output(\n",
+	)
+	f.Fuzz(func(t *testing.T, s string) {
+		flows, _, err := parseDatapathFlows(s, 0)
+		if err != nil {
+			return
+		}
+		for _, flow := range flows {
+			checkFuzzMetric(t, flow.Packets, flow.UFID, flow.InPort, flow.Offloaded, flow.Layer)
+			checkFuzzMetric(t, flow.Bytes, flow.Actions...)
+			if flow.Used != -1 {
+				checkFuzzMetric(t, flow.Used)
+			}
+		}
+	})
+}
+
+func FuzzParseOffloadStats(f *testing.F) {
+	fuzzSeeds(f, "dpctl_offload-stats-show.txt",
+		"   Total  Inserted offloads:   Inf\n",
+		"   Total  \xff offloads:   1\n",
+	)
+	f.Fuzz(func(t *testing.T, s string) {
+		stats, err := parseOffloadStats(s)
+		if err != nil {
+			return
+		}
+		for stat, value := range stats {
+			checkFuzzMetric(t, value, stat)
+		}
+	})
+}
+
+func FuzzParseLogLine(f *testing.F) {
+	f.Add("2024-01-01T00:00:00.000Z|00042|bridge|INFO|bridge br-int: added interface a|b")
+	f.Add("2024-01-01T00:00:00.000Z|00043|timeval|WARN|Unreasonably long 2843ms poll interval (1520ms user, 1100ms system)")
+	f.Add("ovs|00042|\xff|\xfe|message")
+	f.Fuzz(func(t *testing.T, s string) {
+		entry, ok := parseLogLine(s)
+		if !ok {
+			return
+		}
+		checkFuzzMetric(t, 1, entry.Source, entry.Severity)
+	})
+}
+
+func FuzzParsePollInterval(f *testing.F) {
+	f.Add("Unreasonably long 2843ms poll interval (1520ms user, 1100ms system)")
+	f.Add("Unreasonably long 99999999999999999999999999999999999999999999ms poll interval (0ms user, 0ms system)")
+	f.Fuzz(func(t *testing.T, s string) {
+		total, user, system, ok := parsePollInterval(s)
+		if !ok {
+			return
+		}
+		checkFuzzMetric(t, total)
+		checkFuzzMetric(t, user)
+		checkFuzzMetric(t, system)
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden file in testdata/ovs")
+
+// goldenSkipped are the metrics whose values depend on the test run, e.g.
+// on the run directory or the process IDs of the fake OVS.
+var goldenSkipped = map[string]bool{
+	"ovs_info":          true,
+	"ovs_pid":           true,
+	"ovs_next_poll":     true,
+	"ovs_log_file_size": true,
+}
+
+// goldenText returns the metrics of an exporter in the text format and
+// their names, without the metrics in goldenSkipped.
+func goldenText(t *testing.T, exporter *Exporter) ([]byte, []string) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	names := []string{}
+	for _, mf := range mfs {
+		if goldenSkipped[mf.GetName()] {
+			continue
+		}
+		names = append(names, mf.GetName())
+		if _, err := expfmt.MetricFamilyToText(&b, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes(), names
+}
+
+// TestGoldenMetrics compares the metrics exported for the fixture in
+// testdata/ovs/2.17 with its metrics.prom. The fixture is synthetic, see
+// testdata/ovs/README.md. Run `go test -run TestGoldenMetrics -update` to
+// rewrite the golden file after an intended change.
+func TestGoldenMetrics(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+		WithDatapathFlows(0),
+		WithHwOffload(0),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+	exporter.SetPollInterval(15)
+	exporter.GatherMetrics()
+
+	actual, names := goldenText(t, exporter)
+
+	golden := filepath.Join("testdata", "ovs", "2.17", "metrics.prom")
+	if *updateGolden {
+		if err := os.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A metric missing from the golden file would not be compared.
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(expected))
+	if err != nil {
+		t.Fatalf("failed parsing %s: %s", golden, err)
+	}
+	for _, name := range names {
+		if _, exists := families[name]; !exists {
+			t.Errorf("%s is not in %s, run the test with -update", name, golden)
+		}
+	}
+	names = names[:0]
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := testutil.CollectAndCompare(exporter, bytes.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+}
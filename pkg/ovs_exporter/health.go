@@ -0,0 +1,222 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	collectorSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "collector_success"),
+		"Whether a collector succeeded (1) or failed (0) in the last poll, e.g. because OVS refused a command or returned output that could not be parsed.",
+		[]string{"system_id", "collector"}, nil,
+	)
+)
+
+// CollectorStatus is the outcome of a collector in the last poll.
+type CollectorStatus struct {
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// HealthStatus is the body of the /healthz and /readyz endpoints.
+type HealthStatus struct {
+	Status             string            `json:"status"`
+	SystemID           string            `json:"system_id"`
+	LastPoll           *time.Time        `json:"last_poll,omitempty"`
+	LastSuccessfulPoll *time.Time        `json:"last_successful_poll,omitempty"`
+	Collectors         []CollectorStatus `json:"collectors"`
+}
+
+// pollHealth is the outcome of the last poll. It has its own lock, because
+// the exporter is locked for the whole poll, including the queries of OVS,
+// and the health endpoints must not wait for a slow or hung query.
+type pollHealth struct {
+	sync.RWMutex
+	systemID           string
+	pollInterval       int64
+	lastPoll           time.Time
+	lastSuccessfulPoll time.Time
+	errors             map[string][]string
+}
+
+// setPollHealth records the outcome of the current poll. A poll is
+// successful when the system collector read the Open_vSwitch table.
+func (e *Exporter) setPollHealth() {
+	e.health.Lock()
+	defer e.health.Unlock()
+	e.health.systemID = e.system.ID
+	e.health.pollInterval = e.pollInterval
+	e.health.lastPoll = time.Now()
+	if len(e.pollErrors["system"]) == 0 {
+		e.health.lastSuccessfulPoll = e.health.lastPoll
+	}
+	e.health.errors = e.pollErrors
+}
+
+// collectorFailed records the failure of a collector in the current poll
+// and increments the error counter.
+func (e *Exporter) collectorFailed(collector string, component string, err error) {
+	e.IncrementErrorCounter()
+	if e.pollErrors == nil {
+		e.pollErrors = make(map[string][]string)
+	}
+	msg := err.Error()
+	if component != "" {
+		msg = fmt.Sprintf("%s: %s", component, msg)
+	}
+	e.pollErrors[collector] = append(e.pollErrors[collector], msg)
+}
+
+// collectors returns the names of the enabled collectors, in the order in
+// which they run.
+func (e *Exporter) collectors() []string {
+	names := []string{"system"}
+	if e.collectProcessRelatedMetrics {
+		names = append(names, "process")
+		if e.collectProcessResources {
+			names = append(names, "process_resources")
+		}
+		if e.collectVswitchdThreads {
+			names = append(names, "vswitchd_threads")
+		}
+	}
+	names = append(names, "log")
+	if e.collectProcessRelatedMetrics {
+		names = append(names, "appctl", "coverage", "memory", "datapath")
+		if e.collectDatapathFlows {
+			names = append(names, "dp_flows")
+		}
+		if e.collectHwOffload {
+			names = append(names, "hw_offload")
+		}
+	}
+	names = append(names, "interfaces", "network_port")
+	if isSslRemote(e.clientConfig.DatabaseRemote) {
+		names = append(names, "tls")
+	}
+	return names
+}
+
+// gatherCollectorStatus exports whether each enabled collector succeeded in
+// the current poll.
+func (e *Exporter) gatherCollectorStatus() {
+	for _, name := range e.collectors() {
+		value := 1.0
+		if len(e.pollErrors[name]) > 0 {
+			value = 0
+		}
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			collectorSuccess,
+			prometheus.GaugeValue,
+			value,
+			e.system.ID,
+			name,
+		))
+	}
+}
+
+// Health returns the status of the collectors in the last poll. It does not
+// lock the exporter, so it returns while a poll is running. The exporter
+// is ready when the last successful poll is not older than maxMissedPolls
+// poll intervals. A poll is successful when the system collector read the
+// Open_vSwitch table from OVSDB. The failures of other collectors, e.g. of
+// the process collector on hosts without ovn-controller, are reported, but
+// do not affect readiness.
+func (e *Exporter) Health(maxMissedPolls int) (HealthStatus, bool) {
+	e.health.RLock()
+	defer e.health.RUnlock()
+	status := HealthStatus{
+		SystemID:   e.health.systemID,
+		Collectors: []CollectorStatus{},
+	}
+	lastPoll, lastSuccessfulPoll := e.health.lastPoll, e.health.lastSuccessfulPoll
+	if !lastPoll.IsZero() {
+		status.LastPoll = &lastPoll
+	}
+	if !lastSuccessfulPoll.IsZero() {
+		status.LastSuccessfulPoll = &lastSuccessfulPoll
+	}
+	for _, name := range e.collectors() {
+		c := CollectorStatus{Name: name, Status: "ok"}
+		switch {
+		case lastPoll.IsZero():
+			c.Status = "pending"
+		case len(e.health.errors[name]) > 0:
+			c.Status = "failed"
+			c.Errors = e.health.errors[name]
+		}
+		status.Collectors = append(status.Collectors, c)
+	}
+
+	if maxMissedPolls < 1 {
+		maxMissedPolls = 1
+	}
+	interval := e.health.pollInterval
+	if interval < 1 {
+		interval = 1
+	}
+	window := time.Duration(int64(maxMissedPolls)*interval) * time.Second
+	ready := !lastSuccessfulPoll.IsZero() && time.Since(lastSuccessfulPoll) <= window
+	if ready {
+		status.Status = "ok"
+	} else {
+		status.Status = "unavailable"
+	}
+	return status, ready
+}
+
+func writeHealthStatus(w http.ResponseWriter, status HealthStatus, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// HealthzHandler returns a handler reporting that the exporter process is
+// alive. It neither queries OVS nor waits for a running poll, so it is
+// suitable for liveness probes.
+func (e *Exporter) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := e.Health(1)
+		status.Status = "ok"
+		writeHealthStatus(w, status, http.StatusOK)
+	})
+}
+
+// ReadyzHandler returns a handler reporting whether a poll reached OVSDB
+// within maxMissedPolls poll intervals. It responds with 503 Service
+// Unavailable otherwise. When the last poll is older than the poll
+// interval, e.g. because Prometheus scrapes less often, the handler polls
+// OVS itself, so that readiness does not depend on the scrape interval.
+func (e *Exporter) ReadyzHandler(maxMissedPolls int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GatherMetrics returns immediately when the next poll is not due.
+		e.GatherMetrics()
+		status, ready := e.Health(maxMissedPolls)
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealthStatus(w, status, code)
+	})
+}
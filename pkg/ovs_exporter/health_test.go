@@ -0,0 +1,127 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getHealthStatus(t *testing.T, h http.Handler) (HealthStatus, int) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected application/json, but got %q", ct)
+	}
+	var status HealthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed decoding %q: %s", rec.Body.String(), err)
+	}
+	return status, rec.Code
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The host does not run ovn-controller.
+	config := fake.config()
+	config.OvnControllerPidFile = filepath.Join(t.TempDir(), "ovn-controller.pid")
+	exporter := NewExporter(
+		WithClientConfig(config),
+		WithTimeout(2),
+		WithLogger(logger),
+		WithHwOffload(0),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	exporter.SetPollInterval(15)
+
+	// The handler polls OVS, because there was no poll yet. The process
+	// collector fails, but OVSDB was reached.
+	status, code := getHealthStatus(t, exporter.ReadyzHandler(3))
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("expected the exporter to be ready, but got %d %+v", code, status)
+	}
+	found := map[string]CollectorStatus{}
+	for _, c := range status.Collectors {
+		found[c.Name] = c
+	}
+	if c := found["process"]; c.Status != "failed" || len(c.Errors) != 1 || !strings.HasPrefix(c.Errors[0], "ovn-controller: ") {
+		t.Fatalf("unexpected process collector status: %+v", c)
+	}
+	if c := found["system"]; c.Status != "ok" {
+		t.Fatalf("unexpected system collector status: %+v", c)
+	}
+	if c := found["hw_offload"]; c.Status != "ok" {
+		t.Fatalf("unexpected hw_offload collector status: %+v", c)
+	}
+	if _, exists := found["dp_flows"]; exists {
+		t.Fatalf("expected disabled collectors not to be listed")
+	}
+
+	// The last poll is older than three poll intervals, e.g. because
+	// Prometheus scrapes every minute. The handler polls OVS again.
+	exporter.health.lastPoll = time.Now().Add(-time.Minute)
+	exporter.health.lastSuccessfulPoll = exporter.health.lastPoll
+	exporter.nextCollectionTicker = exporter.health.lastPoll.Add(15 * time.Second).Unix()
+	status, code = getHealthStatus(t, exporter.ReadyzHandler(3))
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("expected the exporter to be ready after polling, but got %d %+v", code, status)
+	}
+	if time.Since(*status.LastPoll) > 15*time.Second {
+		t.Fatalf("expected the handler to poll OVS, but the last poll was at %s", status.LastPoll)
+	}
+
+	// A poll is running, e.g. waiting for a hung OVS query. The liveness
+	// endpoint does not wait for it.
+	exporter.Lock()
+	alive := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		exporter.HealthzHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		alive <- rec.Code
+	}()
+	select {
+	case code := <-alive:
+		if code != http.StatusOK {
+			t.Errorf("expected the exporter to be alive during a poll, but got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected /healthz to respond during a poll")
+	}
+	exporter.Unlock()
+
+	// OVSDB is unreachable and the last successful poll is older than
+	// three poll intervals.
+	fake.close()
+	exporter.health.lastSuccessfulPoll = time.Now().Add(-time.Minute)
+	exporter.nextCollectionTicker = 0
+	if status, code := getHealthStatus(t, exporter.ReadyzHandler(3)); code != http.StatusServiceUnavailable || status.Status != "unavailable" {
+		t.Fatalf("expected the exporter not to be ready, but got %d %+v", code, status)
+	}
+	if status, code := getHealthStatus(t, exporter.HealthzHandler()); code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("expected the exporter to be alive, but got %d %+v", code, status)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// OVS Hardware Offload
+	// Reference: https://docs.openvswitch.org/en/latest/howto/tc-offload/
+	hwOffloadEnabled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "hw_offload_enabled"),
+		"Whether hardware offload is enabled in other_config:hw-offload (1) or not (0).",
+		[]string{"system_id"}, nil,
+	)
+	hwOffloadTcPolicy = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "hw_offload_tc_policy"),
+		"The TC policy for hardware offload from other_config:tc-policy. The values of policy are: none, skip_sw, skip_hw. This metric is always 1.",
+		[]string{"system_id", "policy"}, nil,
+	)
+	hwOffloadDpFlows = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "hw_offload_dp_flows"),
+		"The number of flows in a datapath by offload type. The values of type are: offloaded, non-offloaded.",
+		[]string{"system_id", "datapath", "type"}, nil,
+	)
+	hwOffloadStats = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "hw_offload_stats"),
+		"The hardware offload statistics of a datapath from dpctl/offload-stats-show.",
+		[]string{"system_id", "datapath", "stat"}, nil,
+	)
+)
+
+// countDatapathFlows returns the number of flows in the output of
+// `ovs-appctl dpctl/dump-flows`.
+func countDatapathFlows(s string) int {
+	count := 0
+	for _, line := range strings.Split(s, "\n") {
+		if strings.Contains(line, "actions:") {
+			count++
+		}
+	}
+	return count
+}
+
+// normalizeStatName turns a human readable statistic name, e.g.
+// "Cumulative Average latency (us)", into a label value, e.g.
+// "cumulative_average_latency_us".
+func normalizeStatName(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+		if !underscore && b.Len() > 0 {
+			b.WriteRune('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// parseOffloadStats parses the output of `ovs-appctl dpctl/offload-stats-show`,
+// e.g. "   Total  Enqueued offloads:   0". Per-thread statistics and lines
+// without a numeric value are skipped.
+func parseOffloadStats(s string) (map[string]float64, error) {
+	stats := make(map[string]float64)
+	for _, line := range strings.Split(s, "\n") {
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+			return nil, fmt.Errorf("the 'dpctl/offload-stats-show' command return invalid value %q", value)
+		}
+		name := strings.TrimSpace(line[:i])
+		if strings.HasPrefix(name, "[") {
+			continue
+		}
+		name = normalizeStatName(strings.TrimPrefix(name, "Total"))
+		if name == "" {
+			continue
+		}
+		stats[name] = v
+	}
+	return stats, nil
+}
+
+// GetAppDatapathFlowCount returns the number of flows of a datapath by
+// offload type, i.e. offloaded or non-offloaded, from
+// `ovs-appctl dpctl/dump-flows type=<type>`.
+func (c *ovsClient) GetAppDatapathFlowCount(component string, datapath string, flowType string) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	output, err := c.appctl(component, "dpctl/dump-flows", "type="+flowType, datapath)
+	if err != nil {
+		return 0, err
+	}
+	return countDatapathFlows(output), nil
+}
+
+// GetAppOffloadStats returns the hardware offload statistics of a datapath
+// from `ovs-appctl dpctl/offload-stats-show`. Datapaths without offload
+// support, e.g. the kernel datapath, refuse the command and have no
+// statistics.
+func (c *ovsClient) GetAppOffloadStats(component string, datapath string) (map[string]float64, error) {
+	c.Lock()
+	defer c.Unlock()
+	output, err := c.appctl(component, "dpctl/offload-stats-show", datapath)
+	if err != nil {
+		var refused *appctlError
+		if errors.As(err, &refused) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseOffloadStats(output)
+}
+
+// gatherHwOffload collects hardware offload configuration and the number
+// of offloaded datapath flows. The flows are only dumped when hardware
+// offload is enabled. When the datapath flow breakdown dumped the flows of
+// a datapath already, the offloaded flows are counted from that dump.
+// Otherwise, like the breakdown, datapaths with more flows than the limit
+// are not dumped.
+func (e *Exporter) gatherHwOffload(dps []*Datapath, cmds map[string]bool, dumped map[string]map[string]int) {
+	e.logger.Debug("GatherMetrics() calls GetDbOtherConfig()")
+	enabled, known := false, false
+	if config, err := e.client.GetDbOtherConfig(); err != nil {
+		e.logger.Error("GetDbOtherConfig() failed", "error", err.Error())
+		e.collectorFailed("hw_offload", "", err)
+	} else {
+		known = true
+		enabled = config["hw-offload"] == "true"
+		value := 0.0
+		if enabled {
+			value = 1
+		}
+		policy := config["tc-policy"]
+		if policy == "" {
+			policy = "none"
+		}
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			hwOffloadEnabled,
+			prometheus.GaugeValue,
+			value,
+			e.system.ID,
+		))
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			hwOffloadTcPolicy,
+			prometheus.GaugeValue,
+			1,
+			e.system.ID,
+			policy,
+		))
+	}
+	e.logger.Debug("GatherMetrics() completed GetDbOtherConfig()")
+
+	for _, dp := range dps {
+		switch {
+		case !known:
+			// Whether the flows could be offloaded is unknown.
+		case !enabled:
+			// Without hardware offload, all flows stay in the datapath.
+			e.addHwOffloadDpFlows(dp.Name, 0, dp.Flows)
+		case dumped[dp.Name] != nil:
+			// dpctl/dump-flows type=offloaded lists the fully and the
+			// partially offloaded flows.
+			byOffload := dumped[dp.Name]
+			e.addHwOffloadDpFlows(dp.Name, float64(byOffload["yes"]+byOffload["partial"]), float64(byOffload["no"]))
+		default:
+			e.gatherHwOffloadDpFlows(dp)
+		}
+		if !hasCommand(cmds, "dpctl/offload-stats-show") {
+			continue
+		}
+		e.logger.Debug("GatherMetrics() calls GetAppOffloadStats()", "datapath", dp.Name)
+		stats, err := e.client.GetAppOffloadStats("vswitchd-service", dp.Name)
+		if err != nil {
+			e.logger.Error("GetAppOffloadStats() failed", "datapath", dp.Name, "error", err.Error())
+			e.collectorFailed("hw_offload", dp.Name, err)
+			continue
+		}
+		for stat, value := range stats {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				hwOffloadStats,
+				prometheus.GaugeValue,
+				value,
+				e.system.ID,
+				dp.Name,
+				stat,
+			))
+		}
+	}
+}
+
+// addHwOffloadDpFlows adds the number of offloaded and non-offloaded flows
+// of a datapath.
+func (e *Exporter) addHwOffloadDpFlows(datapath string, offloaded float64, nonOffloaded float64) {
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		hwOffloadDpFlows,
+		prometheus.GaugeValue,
+		offloaded,
+		e.system.ID,
+		datapath,
+		"offloaded",
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		hwOffloadDpFlows,
+		prometheus.GaugeValue,
+		nonOffloaded,
+		e.system.ID,
+		datapath,
+		"non-offloaded",
+	))
+}
+
+// gatherHwOffloadDpFlows counts the offloaded and non-offloaded flows of a
+// datapath via `ovs-appctl dpctl/dump-flows type=<type>`, unless the
+// datapath has more flows than the limit.
+func (e *Exporter) gatherHwOffloadDpFlows(dp *Datapath) {
+	if e.hwOffloadFlowsLimit > 0 && dp.Flows > float64(e.hwOffloadFlowsLimit) {
+		e.logger.Debug("gatherHwOffload() skips datapath over flow limit",
+			"datapath", dp.Name,
+			"flows", dp.Flows,
+			"limit", e.hwOffloadFlowsLimit,
+		)
+		return
+	}
+	for _, flowType := range []string{"offloaded", "non-offloaded"} {
+		e.logger.Debug("GatherMetrics() calls GetAppDatapathFlowCount()", "datapath", dp.Name, "type", flowType)
+		count, err := e.client.GetAppDatapathFlowCount("vswitchd-service", dp.Name, flowType)
+		if err != nil {
+			e.logger.Error("GetAppDatapathFlowCount() failed", "datapath", dp.Name, "type", flowType, "error", err.Error())
+			e.collectorFailed("hw_offload", dp.Name, err)
+			continue
+		}
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			hwOffloadDpFlows,
+			prometheus.GaugeValue,
+			float64(count),
+			e.system.ID,
+			dp.Name,
+			flowType,
+		))
+	}
+}
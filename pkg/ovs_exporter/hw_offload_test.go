@@ -0,0 +1,172 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseOffloadStats(t *testing.T) {
+	output := `HW Offload stats:
+   [ 0] Enqueued offloads:                    3
+   [ 0] Inserted offloads:                    5
+   Total  Enqueued offloads:                  3
+   Total  Inserted offloads:                  5
+   Total  Cumulative Average latency (us):    125.5
+`
+	expected := map[string]float64{
+		"enqueued_offloads":             3,
+		"inserted_offloads":             5,
+		"cumulative_average_latency_us": 125.5,
+	}
+	stats, err := parseOffloadStats(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("expected %v, but got %v", expected, stats)
+	}
+	if _, err := parseOffloadStats("   Total  Inserted offloads:   NaN\n"); err == nil {
+		t.Fatalf("expected a NaN statistic to be rejected")
+	}
+}
+
+func TestCountDatapathFlows(t *testing.T) {
+	if n := countDatapathFlows(testDatapathFlows); n != 3 {
+		t.Fatalf("expected 3 flows, but got %d", n)
+	}
+	if n := countDatapathFlows(""); n != 0 {
+		t.Fatalf("expected 0 flows, but got %d", n)
+	}
+}
+
+// enableHwOffload sets other_config:hw-offload in the Open_vSwitch table of
+// the fake.
+func enableHwOffload(fake *fakeOVS) {
+	fake.Lock()
+	defer fake.Unlock()
+	fake.tables["Open_vSwitch"][0]["other_config"] = []interface{}{"map", []interface{}{[]interface{}{"hw-offload", "true"}}}
+}
+
+func TestHwOffloadFlowsLimit(t *testing.T) {
+	logger, err := NewLoggerWithWriter("error", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeOVS(t, "2.17")
+	enableHwOffload(fake)
+	for _, test := range []struct {
+		limit int
+		count int
+	}{
+		{0, 2},
+		{3, 2},
+		// The datapath of the fake has 3 flows, so its flows are not
+		// dumped.
+		{2, 0},
+	} {
+		exporter := NewExporter(WithClientConfig(fake.config()), WithTimeout(2), WithLogger(logger), WithHwOffload(test.limit))
+		if err := exporter.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		exporter.GatherMetrics()
+		if n := testutil.CollectAndCount(exporter, "ovs_hw_offload_dp_flows"); n != test.count {
+			t.Errorf("limit %d: expected %d ovs_hw_offload_dp_flows metrics, but got %d", test.limit, test.count, n)
+		}
+		if n := testutil.CollectAndCount(exporter, "ovs_hw_offload_enabled"); n != 1 {
+			t.Errorf("limit %d: expected ovs_hw_offload_enabled to be collected", test.limit)
+		}
+		exporter.Close()
+	}
+}
+
+func TestHwOffloadDpFlows(t *testing.T) {
+	logger, err := NewLoggerWithWriter("error", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeOVS(t, "2.17")
+	// The replies to the dumps by offload type differ from the flows of
+	// dpctl/dump-flows -m, so that the test tells which were used.
+	fake.setReply("ovs-vswitchd", "dpctl/dump-flows type=offloaded system@ovs-system", "ufid:1, in_port(1), packets:0, bytes:0, used:never, actions:drop\n")
+	fake.setReply("ovs-vswitchd", "dpctl/dump-flows type=non-offloaded system@ovs-system", "")
+	for _, test := range []struct {
+		name         string
+		enabled      bool
+		options      []Option
+		offloaded    int
+		nonOffloaded int
+	}{
+		// Nothing is dumped, all flows of dpctl/show are non-offloaded.
+		{"disabled", false, nil, 0, 3},
+		{"enabled", true, nil, 1, 0},
+		// The flows dumped by the datapath flow breakdown are counted.
+		{"enabled with dp-flows", true, []Option{WithDatapathFlows(0)}, 0, 3},
+	} {
+		if test.enabled {
+			enableHwOffload(fake)
+		}
+		options := append([]Option{WithClientConfig(fake.config()), WithTimeout(2), WithLogger(logger), WithHwOffload(0)}, test.options...)
+		exporter := NewExporter(options...)
+		if err := exporter.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`
+# HELP ovs_hw_offload_dp_flows The number of flows in a datapath by offload type. The values of type are: offloaded, non-offloaded.
+# TYPE ovs_hw_offload_dp_flows gauge
+ovs_hw_offload_dp_flows{datapath="system@ovs-system",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",type="non-offloaded"} %d
+ovs_hw_offload_dp_flows{datapath="system@ovs-system",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",type="offloaded"} %d
+`, test.nonOffloaded, test.offloaded)
+		if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "ovs_hw_offload_dp_flows"); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		exporter.Close()
+	}
+}
+
+func TestGetAppOffloadStats(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	client := NewClient(fake.config(), 2, *slog.Default())
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stats, err := client.GetAppOffloadStats("vswitchd-service", "system@ovs-system")
+	if err != nil || len(stats) == 0 {
+		t.Fatalf("expected offload statistics, but got %v, %v", stats, err)
+	}
+
+	fake.setReply("ovs-vswitchd", "dpctl/offload-stats-show", "  Total  Enqueued offloads: -1\n")
+	if _, err := client.GetAppOffloadStats("vswitchd-service", "system@ovs-system"); err == nil {
+		t.Fatalf("expected malformed statistics to be rejected")
+	}
+
+	// The kernel datapath refuses the command.
+	fake.Lock()
+	delete(fake.replies["ovs-vswitchd"], "dpctl/offload-stats-show")
+	fake.Unlock()
+	stats, err = client.GetAppOffloadStats("vswitchd-service", "system@ovs-system")
+	if err != nil || stats != nil {
+		t.Fatalf("expected no statistics and no error, but got %v, %v", stats, err)
+	}
+}
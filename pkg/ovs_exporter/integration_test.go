@@ -0,0 +1,87 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+
+package ovs_exporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// TestIntegration polls a real OVS installed at the default paths, which
+// has a bridge named br0 and no OVN. It runs as root, e.g.
+//
+//	sudo ovs-vsctl add-br br0
+//	sudo -E env PATH=$PATH go test -tags integration -run TestIntegration ./pkg/ovs_exporter/
+func TestIntegration(t *testing.T) {
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(DefaultClientConfig()),
+		WithTimeout(5),
+		WithLogger(logger),
+		WithDatapathFlows(0),
+		WithProcessResources(),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	defer exporter.Close()
+	exporter.SetPollInterval(15)
+	exporter.GatherMetrics()
+
+	// ovn-controller is not installed, so ovs_up is 0.
+	for collector, msgs := range exporter.pollErrors {
+		for _, msg := range msgs {
+			if !strings.HasPrefix(msg, "ovn-controller") && !strings.HasPrefix(msg, "ovncontroller-service") {
+				t.Errorf("the %s collector failed: %s", collector, msg)
+			}
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&b, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body := b.String()
+	for _, s := range []string{
+		`ovs_info{`,
+		`ovs_coverage_total{component="vswitchd-service"`,
+		`ovs_memory_usage{component="ovsdb-server"`,
+		`ovs_dp_lookups_hit{datapath="system@ovs-system"`,
+		`ovs_interface{bridge_name="br0",name="br0"`,
+		`ovs_process_cpu_seconds_total{component="ovs-vswitchd"`,
+		`ovs_dp_flows{datapath="system@ovs-system"`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected %q in the metrics", s)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// interfaceColumns are the columns of the Interface table the exporter
+// uses. Hosts with thousands of interfaces spend most of a poll decoding
+// the Interface table, so the other columns, e.g. lacp_current, bfd or
+// lldp, are not queried.
+const interfaceColumns = "_uuid, name, type, external_ids, ofport, ifindex, mtu, mac_in_use, " +
+	"link_speed, link_state, admin_state, duplex, ingress_policing_burst, ingress_policing_rate, " +
+	"statistics, status, options"
+
+// interfaceStatistics maps the keys of the statistics column of the
+// Interface table to their metrics.
+var interfaceStatistics = map[string]*prometheus.Desc{
+	"rx_crc_err":           interfaceStatRxCrcError,
+	"rx_dropped":           interfaceStatRxDropped,
+	"rx_frame_err":         interfaceStatRxFrameError,
+	"rx_over_err":          interfaceStatRxOverrunError,
+	"rx_errors":            interfaceStatRxErrorsTotal,
+	"rx_packets":           interfaceStatRxPackets,
+	"rx_bytes":             interfaceStatRxBytes,
+	"tx_packets":           interfaceStatTxPackets,
+	"tx_bytes":             interfaceStatTxBytes,
+	"tx_dropped":           interfaceStatTxDropped,
+	"tx_errors":            interfaceStatTxErrorsTotal,
+	"collisions":           interfaceStatCollisions,
+	"rx_missed_errors":     interfaceStatRxMissedErrors,
+	"rx_multicast_packets": interfaceStateMulticastPackets,
+}
+
+// interfaceMetric is a metric of an interface with the system_id, uuid and
+// name labels. Unlike the metrics of prometheus.NewConstMetric, the metrics
+// of an interface share their label pairs, which are built once per poll.
+// Their values are built once per poll too, so that writing them for a
+// scrape does not allocate.
+type interfaceMetric struct {
+	desc    *prometheus.Desc
+	labels  []*dto.LabelPair
+	counter *dto.Counter
+	gauge   *dto.Gauge
+}
+
+func newInterfaceMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels []*dto.LabelPair) *interfaceMetric {
+	m := &interfaceMetric{desc: desc, labels: labels}
+	if valueType == prometheus.CounterValue {
+		m.counter = &dto.Counter{Value: proto.Float64(value)}
+	} else {
+		m.gauge = &dto.Gauge{Value: proto.Float64(value)}
+	}
+	return m
+}
+
+func (m *interfaceMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *interfaceMetric) Write(out *dto.Metric) error {
+	out.Label = m.labels
+	out.Counter = m.counter
+	out.Gauge = m.gauge
+	return nil
+}
+
+// interfaceLabels returns the label pairs of the metrics of an interface,
+// sorted by label name as required by prometheus.Metric.
+func (e *Exporter) interfaceLabels(intf *Interface) []*dto.LabelPair {
+	return []*dto.LabelPair{
+		{Name: proto.String("name"), Value: proto.String(intf.Name)},
+		{Name: proto.String("system_id"), Value: proto.String(e.system.ID)},
+		{Name: proto.String("uuid"), Value: proto.String(intf.UUID)},
+	}
+}
+
+// getInterfaceBridges returns the names of the bridges of the interfaces
+// by interface UUID.
+func (c *ovsClient) getInterfaceBridges() (map[string]string, error) {
+	query := "SELECT name, ports FROM Bridge"
+	bridges, err := c.transact(query)
+	if err != nil {
+		return nil, fmt.Errorf("the '%s' query failed: %s", query, err)
+	}
+	if len(bridges.Rows) == 0 {
+		return nil, fmt.Errorf("the '%s' query did not return any rows", query)
+	}
+	query = "SELECT _uuid, interfaces FROM Port"
+	ports, err := c.transact(query)
+	if err != nil {
+		return nil, fmt.Errorf("the '%s' query failed: %s", query, err)
+	}
+	if len(ports.Rows) == 0 {
+		return nil, fmt.Errorf("the '%s' query did not return any rows", query)
+	}
+	portInterfaces := make(map[string][]string, len(ports.Rows))
+	for _, row := range ports.Rows {
+		portInterfaces[ovsdbString(row, "_uuid", ports.Columns)] = ovsdbStrings(row, "interfaces", ports.Columns)
+	}
+	interfaceBridges := make(map[string]string, len(ports.Rows))
+	for _, row := range bridges.Rows {
+		name := ovsdbString(row, "name", bridges.Columns)
+		for _, port := range ovsdbStrings(row, "ports", bridges.Columns) {
+			for _, intf := range portInterfaces[port] {
+				interfaceBridges[intf] = name
+			}
+		}
+	}
+	return interfaceBridges, nil
+}
+
+// GetDbInterfaces returns the interfaces of the Interface table. Unlike
+// GetDbInterfaces of ovsdbclient, it only queries the interfaceColumns.
+func (c *ovsClient) GetDbInterfaces() ([]*Interface, error) {
+	c.Lock()
+	defer c.Unlock()
+	interfaceBridges, err := c.getInterfaceBridges()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get bridges and their interfaces: %s", err)
+	}
+	query := "SELECT " + interfaceColumns + " FROM Interface"
+	result, err := c.transact(query)
+	if err != nil {
+		return nil, fmt.Errorf("the '%s' query failed: %s", query, err)
+	}
+	if len(result.Rows) == 0 {
+		return nil, fmt.Errorf("the '%s' query did not return any rows", query)
+	}
+	intfs := make([]*Interface, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		intf := &Interface{
+			UUID:       ovsdbString(row, "_uuid", result.Columns),
+			Name:       ovsdbString(row, "name", result.Columns),
+			Type:       ovsdbString(row, "type", result.Columns),
+			MacInUse:   ovsdbString(row, "mac_in_use", result.Columns),
+			LinkState:  ovsdbString(row, "link_state", result.Columns),
+			AdminState: ovsdbString(row, "admin_state", result.Columns),
+			Duplex:     ovsdbString(row, "duplex", result.Columns),
+		}
+		if intf.UUID == "" {
+			continue
+		}
+		intf.BridgeName = interfaceBridges[intf.UUID]
+		intf.OfPort = ovsdbInteger(row, "ofport")
+		intf.IfIndex = ovsdbInteger(row, "ifindex")
+		intf.Mtu = ovsdbInteger(row, "mtu")
+		intf.LinkSpeed = ovsdbInteger(row, "link_speed")
+		intf.IngressPolicingBurst = ovsdbInteger(row, "ingress_policing_burst")
+		intf.IngressPolicingRate = ovsdbInteger(row, "ingress_policing_rate")
+		intf.ExternalIDs = ovsdbStringMap(row, "external_ids", result.Columns)
+		intf.Status = ovsdbStringMap(row, "status", result.Columns)
+		intf.Options = ovsdbStringMap(row, "options", result.Columns)
+		intf.Statistics = map[string]int{}
+		if data, dataType, err := row.GetColumnValue("statistics", result.Columns); err == nil && dataType == "map[string]integer" {
+			intf.Statistics = data.(map[string]int)
+		}
+		intfs = append(intfs, intf)
+	}
+	return intfs, nil
+}
+
+// gatherInterfaceMetrics adds the metrics of the interfaces of the
+// Interface table.
+func (e *Exporter) gatherInterfaceMetrics(intfs []*Interface) {
+	for _, intf := range intfs {
+		labels := e.interfaceLabels(intf)
+		add := func(desc *prometheus.Desc, valueType prometheus.ValueType, value float64) {
+			e.metrics = append(e.metrics, newInterfaceMetric(desc, valueType, value, labels))
+		}
+
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			interfaceMain,
+			prometheus.GaugeValue,
+			1,
+			e.system.ID,
+			intf.UUID,
+			intf.Name,
+			intf.BridgeName,
+		))
+		add(interfaceAdminState, prometheus.GaugeValue, interfaceState(intf.AdminState))
+		add(interfaceLinkState, prometheus.GaugeValue, interfaceState(intf.LinkState))
+		add(interfaceIngressPolicingBurst, prometheus.GaugeValue, intf.IngressPolicingBurst)
+		add(interfaceIngressPolicingRate, prometheus.GaugeValue, intf.IngressPolicingRate)
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			interfaceMacInUse,
+			prometheus.GaugeValue,
+			1,
+			e.system.ID,
+			intf.UUID,
+			intf.MacInUse,
+			intf.Name,
+		))
+		add(interfaceMtu, prometheus.GaugeValue, intf.Mtu)
+		var linkDuplex float64
+		switch intf.Duplex {
+		case "half":
+			linkDuplex = 1
+		case "full":
+			linkDuplex = 2
+		default:
+			linkDuplex = 0
+		}
+		add(interfaceDuplex, prometheus.GaugeValue, linkDuplex)
+		add(interfaceOfPort, prometheus.GaugeValue, intf.OfPort)
+		add(interfaceIfIndex, prometheus.GaugeValue, intf.IfIndex)
+		add(interfaceLocalIndex, prometheus.GaugeValue, intf.Index)
+		for key, value := range intf.Statistics {
+			desc, exists := interfaceStatistics[key]
+			if !exists {
+				e.logger.Debug("detected malformed interface statistics",
+					"key", key,
+					"value", value,
+					"error", "OVS interface statistics has unsupported key",
+				)
+				continue
+			}
+			add(desc, prometheus.CounterValue, float64(value))
+		}
+		add(interfaceLinkResets, prometheus.CounterValue, intf.LinkResets)
+		add(interfaceLinkSpeed, prometheus.GaugeValue, intf.LinkSpeed)
+		for key, value := range intf.Status {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				interfaceStatusKeyValuePair,
+				prometheus.GaugeValue,
+				1,
+				e.system.ID,
+				intf.UUID,
+				key,
+				value,
+				intf.Name,
+			))
+		}
+		for key, value := range intf.Options {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				interfaceOptionsKeyValuePair,
+				prometheus.GaugeValue,
+				1,
+				e.system.ID,
+				intf.UUID,
+				key,
+				value,
+				intf.Name,
+			))
+		}
+		for key, value := range intf.ExternalIDs {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				interfaceExternalIdKeyValuePair,
+				prometheus.GaugeValue,
+				1,
+				e.system.ID,
+				intf.UUID,
+				key,
+				value,
+				intf.Name,
+			))
+		}
+	}
+}
+
+// interfaceState returns the value of the admin_state or link_state of an
+// interface: down(0), up(1), other(2).
+func interfaceState(state string) float64 {
+	switch state {
+	case "down":
+		return 0
+	case "up":
+		return 1
+	}
+	return 2
+}
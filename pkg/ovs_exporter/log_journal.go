@@ -0,0 +1,201 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"time"
+)
+
+// journalPriorities maps syslog priorities of journal entries to OVS log
+// severity levels.
+var journalPriorities = map[string]string{
+	"0": "emer",
+	"1": "emer",
+	"2": "emer",
+	"3": "err",
+	"4": "warn",
+	"5": "info",
+	"6": "info",
+	"7": "dbg",
+}
+
+// journalEntry holds the cursor and the fields of a journal entry, e.g.
+// MESSAGE, PRIORITY and SYSLOG_IDENTIFIER.
+type journalEntry struct {
+	Cursor string
+	Fields map[string]string
+}
+
+// logEntry converts the journal entry to a log entry. OVS messages keep the
+// "ovs|00042|bridge|INFO|..." format of the syslog and console log
+// destinations. Other messages are attributed by journal fields.
+func (j journalEntry) logEntry() (logEntry, bool) {
+	message, exists := j.Fields["MESSAGE"]
+	if !exists {
+		return logEntry{}, false
+	}
+	if entry, ok := parseLogLine(message); ok {
+		return entry, true
+	}
+	severity, exists := journalPriorities[j.Fields["PRIORITY"]]
+	if !exists {
+		severity = "info"
+	}
+	return logEntry{
+		Source:   j.Fields["SYSLOG_IDENTIFIER"],
+		Severity: severity,
+		Message:  message,
+	}, true
+}
+
+// journal is an open systemd journal, filtered by unit. See
+// log_journal_sdjournal.go for the implementation on top of libsystemd.
+type journal interface {
+	SeekTail() error
+	SeekCursor(cursor string) error
+	SeekRealtimeUsec(usec uint64) error
+	TestCursor(cursor string) error
+	Next() (uint64, error)
+	Previous() (uint64, error)
+	// Wait processes the changes of the journal files, e.g. new files
+	// after a rotation, waiting at most timeout for them.
+	Wait(timeout time.Duration) int
+	GetEntry() (journalEntry, error)
+	Close() error
+}
+
+// journalReader reads the journal entries of a systemd unit appended since
+// the previous poll. The journal files are read directly, via the journal
+// API of libsystemd. The reader keeps the journal open between polls, and
+// tracks the cursor of the last entry it read, so that it resumes after
+// that entry when the journal has to be reopened. Until the journal of the
+// unit has an entry, the reader resumes from the time of the first poll.
+type journalReader struct {
+	unit      string
+	directory string
+	open      func(unit, directory string) (journal, error)
+	journal   journal
+	cursor    string
+	since     time.Time
+}
+
+func newJournalReader(unit, directory string) *journalReader {
+	return &journalReader{
+		unit:      unit,
+		directory: directory,
+		open:      openJournal,
+	}
+}
+
+// seek opens the journal and positions it on the last entry read, or on
+// the last entry of the journal on the first poll.
+func (j *journalReader) seek() error {
+	now := time.Now()
+	jr, err := j.open(j.unit, j.directory)
+	if err != nil {
+		return err
+	}
+	switch {
+	case j.cursor != "":
+		if err := jr.SeekCursor(j.cursor); err != nil {
+			jr.Close()
+			return err
+		}
+		// The seek positions the journal before the entry of the cursor.
+		// The entry was read before, unless it was vacuumed meanwhile.
+		if _, err := jr.Next(); err != nil {
+			jr.Close()
+			return err
+		}
+		if err := jr.TestCursor(j.cursor); err != nil {
+			if _, err := jr.Previous(); err != nil {
+				jr.Close()
+				return err
+			}
+		}
+	case !j.since.IsZero():
+		// The journal was empty so far, so the entries appended since the
+		// first poll are read.
+		if err := jr.SeekRealtimeUsec(uint64(j.since.UnixMicro())); err != nil {
+			jr.Close()
+			return err
+		}
+	default:
+		if err := jr.SeekTail(); err != nil {
+			jr.Close()
+			return err
+		}
+		n, err := jr.Previous()
+		if err != nil {
+			jr.Close()
+			return err
+		}
+		// The cursor of the last entry is kept, so that the entries
+		// appended meanwhile are read when the journal is reopened
+		// before the next entry was read.
+		j.since = now
+		if n > 0 {
+			entry, err := jr.GetEntry()
+			if err != nil {
+				jr.Close()
+				return err
+			}
+			j.cursor = entry.Cursor
+		}
+	}
+	j.journal = jr
+	return nil
+}
+
+// Poll passes the journal entries of the unit appended since the previous
+// poll to fn. The first poll only records the position of the last entry.
+func (j *journalReader) Poll(fn func(logEntry)) error {
+	if j.journal == nil {
+		if err := j.seek(); err != nil {
+			return err
+		}
+	} else {
+		j.journal.Wait(0)
+	}
+	for {
+		n, err := j.journal.Next()
+		if err == nil && n == 0 {
+			return nil
+		}
+		var entry journalEntry
+		if err == nil {
+			entry, err = j.journal.GetEntry()
+		}
+		if err != nil {
+			// The journal is reopened at the cursor on the next poll.
+			j.Close()
+			return err
+		}
+		if entry.Cursor != "" {
+			j.cursor = entry.Cursor
+		}
+		if le, ok := entry.logEntry(); ok {
+			fn(le)
+		}
+	}
+}
+
+// Close implements logSource.
+func (j *journalReader) Close() {
+	if j.journal != nil {
+		j.journal.Close()
+		j.journal = nil
+	}
+}
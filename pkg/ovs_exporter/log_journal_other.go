@@ -0,0 +1,30 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux || !cgo || !journald
+
+package ovs_exporter
+
+import (
+	"fmt"
+)
+
+// JournaldSupported tells whether the exporter was built with support for
+// reading logs from the systemd journal, i.e. with cgo and the journald
+// build tag.
+const JournaldSupported = false
+
+func openJournal(unit, directory string) (journal, error) {
+	return nil, fmt.Errorf("reading the journal of %s is not supported by this build, which lacks cgo or the journald build tag", unit)
+}
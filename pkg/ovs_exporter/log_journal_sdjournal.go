@@ -0,0 +1,67 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && cgo && journald
+
+package ovs_exporter
+
+import (
+	"github.com/coreos/go-systemd/v22/sdjournal"
+)
+
+// JournaldSupported tells whether the exporter was built with support for
+// reading logs from the systemd journal, i.e. with cgo and the journald
+// build tag.
+const JournaldSupported = true
+
+// sdJournal is a journal read by libsystemd, which is loaded at runtime.
+type sdJournal struct {
+	*sdjournal.Journal
+}
+
+// openJournal opens the journal files of the system, or of a directory,
+// and filters them by unit. Like `journalctl --unit`, the entries of the
+// unit and the messages of systemd about the unit are read.
+func openJournal(unit, directory string) (journal, error) {
+	var j *sdjournal.Journal
+	var err error
+	if directory == "" {
+		j, err = sdjournal.NewJournal()
+	} else {
+		j, err = sdjournal.NewJournalFromDir(directory)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, add := range []func() error{
+		func() error { return j.AddMatch(sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT + "=" + unit) },
+		j.AddDisjunction,
+		func() error { return j.AddMatch(sdjournal.SD_JOURNAL_FIELD_PID + "=1") },
+		func() error { return j.AddMatch("UNIT=" + unit) },
+	} {
+		if err := add(); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	return sdJournal{j}, nil
+}
+
+func (j sdJournal) GetEntry() (journalEntry, error) {
+	entry, err := j.Journal.GetEntry()
+	if err != nil {
+		return journalEntry{}, err
+	}
+	return journalEntry{Cursor: entry.Cursor, Fields: entry.Fields}, nil
+}
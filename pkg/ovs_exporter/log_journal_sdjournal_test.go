@@ -0,0 +1,32 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && cgo && journald
+
+package ovs_exporter
+
+import (
+	"testing"
+)
+
+// TestSdJournal reads an empty journal directory via libsystemd.
+func TestSdJournal(t *testing.T) {
+	reader := newJournalReader("ovs-vswitchd.service", t.TempDir())
+	defer reader.Close()
+	for i := 0; i < 2; i++ {
+		if messages := pollJournal(t, reader); len(messages) != 0 {
+			t.Fatalf("expected no entries, but got %v", messages)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeJournal is an in-memory journal with the positioning semantics of
+// sd_journal: the current entry is moved by Next and Previous, and
+// SeekCursor and SeekTail position the journal between entries.
+type fakeJournal struct {
+	entries []journalEntry
+	times   []uint64
+	seq     int
+	current int
+	err     error
+	closed  bool
+}
+
+// add appends entries with increasing cursors.
+func (f *fakeJournal) add(fields ...map[string]string) {
+	for _, field := range fields {
+		f.seq++
+		f.entries = append(f.entries, journalEntry{Cursor: fmt.Sprintf("c%03d", f.seq), Fields: field})
+		f.times = append(f.times, uint64(time.Now().UnixMicro()))
+	}
+}
+
+func (f *fakeJournal) SeekTail() error {
+	f.current = len(f.entries)
+	return nil
+}
+
+func (f *fakeJournal) SeekCursor(cursor string) error {
+	f.current = len(f.entries) - 1
+	for i, entry := range f.entries {
+		if entry.Cursor >= cursor {
+			f.current = i - 1
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeJournal) SeekRealtimeUsec(usec uint64) error {
+	f.current = len(f.entries) - 1
+	for i, t := range f.times {
+		if t >= usec {
+			f.current = i - 1
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeJournal) TestCursor(cursor string) error {
+	if f.current < 0 || f.current >= len(f.entries) || f.entries[f.current].Cursor != cursor {
+		return fmt.Errorf("cursor %s does not match", cursor)
+	}
+	return nil
+}
+
+func (f *fakeJournal) Next() (uint64, error) {
+	if f.err != nil {
+		err := f.err
+		f.err = nil
+		return 0, err
+	}
+	if f.current+1 >= len(f.entries) {
+		return 0, nil
+	}
+	f.current++
+	return 1, nil
+}
+
+func (f *fakeJournal) Previous() (uint64, error) {
+	if f.current-1 < 0 {
+		f.current = -1
+		return 0, nil
+	}
+	f.current--
+	return 1, nil
+}
+
+func (f *fakeJournal) Wait(timeout time.Duration) int {
+	return 0
+}
+
+func (f *fakeJournal) GetEntry() (journalEntry, error) {
+	return f.entries[f.current], nil
+}
+
+func (f *fakeJournal) Close() error {
+	f.closed = true
+	return nil
+}
+
+// newFakeJournalReader returns a reader of a fake journal, and the number
+// of times the journal was opened.
+func newFakeJournalReader(fake *fakeJournal) (*journalReader, *int) {
+	opened := 0
+	reader := newJournalReader("ovs-vswitchd.service", "")
+	reader.open = func(unit, directory string) (journal, error) {
+		opened++
+		fake.closed = false
+		return fake, nil
+	}
+	return reader, &opened
+}
+
+func pollJournal(t *testing.T, reader *journalReader) []string {
+	t.Helper()
+	messages := []string{}
+	if err := reader.Poll(func(entry logEntry) { messages = append(messages, entry.Message) }); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	return messages
+}
+
+func TestJournalReader(t *testing.T) {
+	fake := &fakeJournal{}
+	fake.add(map[string]string{"MESSAGE": "ovs|00001|bridge|INFO|old", "PRIORITY": "6"})
+	reader, opened := newFakeJournalReader(fake)
+
+	// The first poll only records the position of the last entry.
+	if messages := pollJournal(t, reader); len(messages) != 0 {
+		t.Fatalf("expected no entries, but got %v", messages)
+	}
+
+	fake.add(
+		map[string]string{"MESSAGE": "ovs|00002|timeval|WARN|Unreasonably long 2000ms poll interval (1000ms user, 500ms system)", "PRIORITY": "4", "SYSLOG_IDENTIFIER": "ovs-vswitchd"},
+		map[string]string{"MESSAGE": "Started Open vSwitch Forwarding Unit.", "PRIORITY": "6", "SYSLOG_IDENTIFIER": "systemd"},
+		map[string]string{"PRIORITY": "6"},
+	)
+	entries := []logEntry{}
+	if err := reader.Poll(func(entry logEntry) { entries = append(entries, entry) }); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	expectedEntries := []logEntry{
+		{
+			Timestamp: "ovs",
+			Sequence:  "00002",
+			Source:    "timeval",
+			Severity:  "warn",
+			Message:   "Unreasonably long 2000ms poll interval (1000ms user, 500ms system)",
+		},
+		{
+			Source:   "systemd",
+			Severity: "info",
+			Message:  "Started Open vSwitch Forwarding Unit.",
+		},
+	}
+	if !reflect.DeepEqual(entries, expectedEntries) {
+		t.Fatalf("expected %+v, but got %+v", expectedEntries, entries)
+	}
+	if reader.cursor != "c004" {
+		t.Fatalf("expected cursor c004, but got %q", reader.cursor)
+	}
+
+	// After an error, the journal is reopened at the cursor, so that no
+	// entry is read twice or skipped.
+	fake.err = fmt.Errorf("journal file corrupted")
+	if err := reader.Poll(func(logEntry) {}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !fake.closed {
+		t.Fatalf("expected the journal to be closed after an error")
+	}
+	fake.add(map[string]string{"MESSAGE": "a"})
+	if messages := pollJournal(t, reader); !reflect.DeepEqual(messages, []string{"a"}) {
+		t.Fatalf("unexpected entries: %v", messages)
+	}
+
+	// When the entry of the cursor was vacuumed, the reader resumes with
+	// the next one.
+	reader.Close()
+	fake.add(map[string]string{"MESSAGE": "b"}, map[string]string{"MESSAGE": "c"})
+	fake.entries = fake.entries[len(fake.entries)-2:]
+	if messages := pollJournal(t, reader); !reflect.DeepEqual(messages, []string{"b", "c"}) {
+		t.Fatalf("unexpected entries: %v", messages)
+	}
+	if *opened != 3 {
+		t.Fatalf("expected the journal to be opened 3 times, but got %d", *opened)
+	}
+	if messages := pollJournal(t, reader); len(messages) != 0 {
+		t.Fatalf("expected no entries, but got %v", messages)
+	}
+}
+
+func TestJournalReaderEmptyJournal(t *testing.T) {
+	fake := &fakeJournal{}
+	reader, _ := newFakeJournalReader(fake)
+	if messages := pollJournal(t, reader); len(messages) != 0 {
+		t.Fatalf("expected no entries, but got %v", messages)
+	}
+	fake.add(map[string]string{"MESSAGE": "a"}, map[string]string{"MESSAGE": "b"})
+	if messages := pollJournal(t, reader); !reflect.DeepEqual(messages, []string{"a", "b"}) {
+		t.Fatalf("unexpected entries: %v", messages)
+	}
+}
+
+// TestJournalReaderReopen reopens the journal before an entry was read
+// since the first poll. The entries appended meanwhile are read.
+func TestJournalReaderReopen(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		entries []map[string]string
+	}{
+		{"tail cursor", []map[string]string{{"MESSAGE": "old"}}},
+		{"empty journal", nil},
+	} {
+		fake := &fakeJournal{}
+		fake.add(test.entries...)
+		reader, _ := newFakeJournalReader(fake)
+		if messages := pollJournal(t, reader); len(messages) != 0 {
+			t.Fatalf("%s: expected no entries, but got %v", test.name, messages)
+		}
+		fake.err = fmt.Errorf("journal file corrupted")
+		if err := reader.Poll(func(logEntry) {}); err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+		fake.add(map[string]string{"MESSAGE": "a"}, map[string]string{"MESSAGE": "b"})
+		if messages := pollJournal(t, reader); !reflect.DeepEqual(messages, []string{"a", "b"}) {
+			t.Fatalf("%s: unexpected entries: %v", test.name, messages)
+		}
+	}
+}
+
+func TestJournalReaderUnsupported(t *testing.T) {
+	if JournaldSupported {
+		t.Skip("the exporter was built with journald support")
+	}
+	if err := newJournalReader("ovs-vswitchd.service", "").Poll(func(logEntry) {}); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestGatherLogEventsJournald(t *testing.T) {
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewExporter(
+		WithTimeout(2),
+		WithLogger(logger),
+		WithJournal("", nil),
+	)
+	fake := &fakeJournal{}
+	reader, _ := newFakeJournalReader(fake)
+	e.logSources = map[string]logSource{"ovs-vswitchd": reader}
+
+	if err := e.gatherLogEvents("ovs-vswitchd"); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	fake.add(map[string]string{"MESSAGE": "ovs|00002|timeval|WARN|Unreasonably long 2000ms poll interval (1000ms user, 500ms system)", "PRIORITY": "4"})
+	e.metrics = nil
+	if err := e.gatherLogEvents("ovs-vswitchd"); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if e.logSources["ovs-vswitchd"] != reader {
+		t.Fatalf("expected the journal reader to be reused")
+	}
+	if v := e.logEvents["ovs-vswitchd"]["warn"]["timeval"]; v != 1 {
+		t.Fatalf("expected 1 warning, but got %v", v)
+	}
+	if stat := e.pollIntervalStat("ovs-vswitchd"); stat.count != 1 {
+		t.Fatalf("expected 1 long poll interval, but got %d", stat.count)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	logPatternMatches = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "log_pattern_matches_total"),
+		"The total number of log messages of an OVN component matching a user-defined rule since the exporter started.",
+		[]string{"system_id", "component", "rule"}, nil,
+	)
+	logPatternValue = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "log_pattern_value"),
+		"The distribution of the numeric value captured by a user-defined rule from the log messages of an OVN component.",
+		[]string{"system_id", "component", "rule"}, nil,
+	)
+)
+
+// logComponents are the components whose logs are read by the exporter.
+var logComponents = []string{
+	"ovsdb-server",
+	"ovs-vswitchd",
+	"ovn-controller",
+}
+
+var defaultLogPatternBuckets = prometheus.ExponentialBuckets(1, 4, 10)
+
+// LogPatternRule is a named regular expression applied to the messages of
+// OVS logs.
+type LogPatternRule struct {
+	// Name is the value of the rule label.
+	Name string `yaml:"name"`
+	// Pattern is matched against the message part of a log line.
+	Pattern string `yaml:"pattern"`
+	// Components limits the rule to the logs of the listed components. By
+	// default, the rule applies to all of them.
+	Components []string `yaml:"components"`
+	// ValueGroup is the index of a capture group with a numeric value. When
+	// set, the values are observed in a histogram.
+	ValueGroup int `yaml:"value_group"`
+	// Buckets are the upper bounds of the histogram buckets.
+	Buckets []float64 `yaml:"buckets"`
+
+	re *regexp.Regexp
+}
+
+// LogPatternConfig is the configuration file of log pattern rules.
+type LogPatternConfig struct {
+	Rules []*LogPatternRule `yaml:"rules"`
+}
+
+// appliesTo returns true when the rule applies to the log of a component.
+func (r *LogPatternRule) appliesTo(component string) bool {
+	if len(r.Components) == 0 {
+		return true
+	}
+	for _, c := range r.Components {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// compile validates the rule and compiles its pattern.
+func (r *LogPatternRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule has no name")
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("rule %s has invalid pattern: %s", r.Name, err)
+	}
+	if r.ValueGroup < 0 || r.ValueGroup > re.NumSubexp() {
+		return fmt.Errorf("rule %s has value_group %d, but the pattern has %d groups", r.Name, r.ValueGroup, re.NumSubexp())
+	}
+	for _, c := range r.Components {
+		supported := false
+		for _, lc := range logComponents {
+			if c == lc {
+				supported = true
+			}
+		}
+		if !supported {
+			return fmt.Errorf("rule %s has unsupported component %s", r.Name, c)
+		}
+	}
+	if r.ValueGroup > 0 && len(r.Buckets) == 0 {
+		r.Buckets = defaultLogPatternBuckets
+	}
+	sort.Float64s(r.Buckets)
+	r.re = re
+	return nil
+}
+
+// LoadLogPatternRules reads log pattern rules from a YAML file, e.g.
+//
+//	rules:
+//	  - name: long_poll_interval
+//	    pattern: 'Unreasonably long (\d+)ms poll interval'
+//	    components: [ovs-vswitchd, ovn-controller]
+//	    value_group: 1
+func LoadLogPatternRules(path string) ([]*LogPatternRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config LogPatternConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed parsing %s: %s", path, err)
+	}
+	names := make(map[string]bool)
+	for _, r := range config.Rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("failed parsing %s: %s", path, err)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("failed parsing %s: duplicate rule %s", path, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return config.Rules, nil
+}
+
+// logPatternStat holds the matches of a rule in the log of a component.
+type logPatternStat struct {
+	matches float64
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+// matchLogPatterns applies the rules to a log message of a component.
+func (e *Exporter) matchLogPatterns(component string, message string) {
+	for _, r := range e.logPatternRules {
+		if !r.appliesTo(component) {
+			continue
+		}
+		m := r.re.FindStringSubmatch(message)
+		if m == nil {
+			continue
+		}
+		stat := e.logPatternStat(component, r)
+		stat.matches++
+		if r.ValueGroup == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[r.ValueGroup], 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		stat.count++
+		stat.sum += v
+		for _, b := range r.Buckets {
+			if v <= b {
+				stat.buckets[b]++
+			}
+		}
+	}
+}
+
+func (e *Exporter) logPatternStat(component string, r *LogPatternRule) *logPatternStat {
+	if e.logPatternStats == nil {
+		e.logPatternStats = make(map[string]map[string]*logPatternStat)
+	}
+	if _, exists := e.logPatternStats[component]; !exists {
+		e.logPatternStats[component] = make(map[string]*logPatternStat)
+	}
+	stat, exists := e.logPatternStats[component][r.Name]
+	if !exists {
+		stat = &logPatternStat{buckets: make(map[float64]uint64, len(r.Buckets))}
+		for _, b := range r.Buckets {
+			stat.buckets[b] = 0
+		}
+		e.logPatternStats[component][r.Name] = stat
+	}
+	return stat
+}
+
+// collectLogPatterns exports the matches of the rules applying to the log
+// of a component.
+func (e *Exporter) collectLogPatterns(component string) {
+	for _, r := range e.logPatternRules {
+		if !r.appliesTo(component) {
+			continue
+		}
+		stat := e.logPatternStat(component, r)
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			logPatternMatches,
+			prometheus.CounterValue,
+			stat.matches,
+			e.system.ID,
+			component,
+			r.Name,
+		))
+		if r.ValueGroup == 0 {
+			continue
+		}
+		buckets := make(map[float64]uint64, len(stat.buckets))
+		for b, c := range stat.buckets {
+			buckets[b] = c
+		}
+		e.metrics = append(e.metrics, prometheus.MustNewConstHistogram(
+			logPatternValue,
+			stat.count,
+			stat.sum,
+			buckets,
+			e.system.ID,
+			component,
+			r.Name,
+		))
+	}
+}
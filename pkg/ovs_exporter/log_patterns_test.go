@@ -0,0 +1,94 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLogPatternRules(t *testing.T) {
+	rules, err := LoadLogPatternRules("../../assets/log_patterns/ovs_log_patterns.yml")
+	if err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("expected 5 rules, but got %d", len(rules))
+	}
+
+	invalid := map[string]string{
+		"pattern":   "rules:\n  - name: x\n    pattern: '('\n",
+		"group":     "rules:\n  - name: x\n    pattern: 'a'\n    value_group: 1\n",
+		"component": "rules:\n  - name: x\n    pattern: 'a'\n    components: [ovn-northd]\n",
+		"duplicate": "rules:\n  - name: x\n    pattern: 'a'\n  - name: x\n    pattern: 'b'\n",
+		"unknown":   "rules:\n  - name: x\n    regex: 'a'\n",
+	}
+	for name, config := range invalid {
+		path := filepath.Join(t.TempDir(), name+".yml")
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadLogPatternRules(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMatchLogPatterns(t *testing.T) {
+	rules, err := LoadLogPatternRules("../../assets/log_patterns/ovs_log_patterns.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithTimeout(2),
+		WithLogger(logger),
+		WithLogPatternRules(rules),
+	)
+	messages := []string{
+		"Unreasonably long 2843ms poll interval (1520ms user, 1100ms system)",
+		"Unreasonably long 1200ms poll interval (1000ms user, 10ms system)",
+		"Dropped 12 log messages in last 60 seconds (most recently, 3 seconds ago) due to excessive rate",
+		"bridge br-ex: could not open network device eth5 (No such device)",
+	}
+	for _, m := range messages {
+		exporter.matchLogPatterns("ovs-vswitchd", m)
+	}
+	exporter.matchLogPatterns("ovsdb-server", messages[0])
+
+	stat := exporter.logPatternStats["ovs-vswitchd"]["long_poll_interval"]
+	if stat.matches != 2 || stat.count != 2 || stat.sum != 4043 {
+		t.Fatalf("unexpected long_poll_interval stats: %+v", stat)
+	}
+	if stat.buckets[2000] != 1 || stat.buckets[5000] != 2 {
+		t.Fatalf("unexpected long_poll_interval buckets: %v", stat.buckets)
+	}
+	if _, exists := exporter.logPatternStats["ovsdb-server"]["long_poll_interval"]; exists {
+		t.Fatalf("expected long_poll_interval not to apply to ovsdb-server")
+	}
+	if exporter.logPatternStats["ovs-vswitchd"]["dropped_log_messages"].sum != 12 {
+		t.Fatalf("unexpected dropped_log_messages stats")
+	}
+
+	exporter.collectLogPatterns("ovs-vswitchd")
+	// 5 counters and 2 histograms
+	if len(exporter.metrics) != 7 {
+		t.Fatalf("expected 7 metrics, but got %d", len(exporter.metrics))
+	}
+}
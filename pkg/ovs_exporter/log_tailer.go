@@ -0,0 +1,130 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// logTailer reads the lines appended to a log file since the previous poll.
+// It follows the file across rotation, i.e. when the path points to a new
+// inode, and truncation, i.e. when the file shrinks. The generation of the
+// tailer changes whenever it starts reading a file from its beginning.
+type logTailer struct {
+	path       string
+	file       *os.File
+	inode      uint64
+	offset     int64
+	generation int
+}
+
+func newLogTailer(path string) *logTailer {
+	return &logTailer{path: path}
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+// open opens the file at the path of the tailer and reads it from its
+// beginning.
+func (t *logTailer) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.file = file
+	t.inode = fileInode(info)
+	t.offset = 0
+	t.generation++
+	return nil
+}
+
+// Close releases the file held by the tailer.
+func (t *logTailer) Close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// readLines passes the complete lines after the current offset to fn. An
+// incomplete last line is left for the next poll.
+func (t *logTailer) readLines(fn func(string)) error {
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(t.file, 64*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		t.offset += int64(len(line))
+		fn(strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// Poll passes the lines appended to the log file since the previous poll
+// to fn. The first poll passes the existing content of the file.
+func (t *logTailer) Poll(fn func(string)) error {
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			return err
+		}
+		return t.readLines(fn)
+	}
+
+	info, err := os.Stat(t.path)
+	switch {
+	case err != nil && os.IsNotExist(err):
+		// The file was rotated, but not recreated yet. Keep reading the
+		// old file.
+		return t.readLines(fn)
+	case err != nil:
+		return err
+	case fileInode(info) != t.inode:
+		// The file was rotated. Drain the old file, then follow the new
+		// one from its beginning.
+		if err := t.readLines(fn); err != nil {
+			return err
+		}
+		t.Close()
+		if err := t.open(); err != nil {
+			return err
+		}
+		return t.readLines(fn)
+	case info.Size() < t.offset:
+		// The file was truncated in place, e.g. by copytruncate.
+		t.offset = 0
+		t.generation++
+	}
+	return t.readLines(fn)
+}
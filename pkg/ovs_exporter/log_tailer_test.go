@@ -0,0 +1,189 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pollLines(t *testing.T, tailer *logTailer) []string {
+	t.Helper()
+	lines := []string{}
+	if err := tailer.Poll(func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	return lines
+}
+
+func TestLogTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ovs-vswitchd.log")
+	appendFile(t, path, "old 1\nold 2\n")
+
+	tailer := newLogTailer(path)
+	defer tailer.Close()
+
+	// The first poll reads the existing content.
+	if lines := pollLines(t, tailer); !reflect.DeepEqual(lines, []string{"old 1", "old 2"}) {
+		t.Fatalf("unexpected lines: %v", lines)
+	}
+	generation := tailer.generation
+
+	// An incomplete line is held back until it is complete.
+	appendFile(t, path, "new 1\nnew 2")
+	if lines := pollLines(t, tailer); !reflect.DeepEqual(lines, []string{"new 1"}) {
+		t.Fatalf("unexpected lines: %v", lines)
+	}
+	appendFile(t, path, " done\n")
+	if lines := pollLines(t, tailer); !reflect.DeepEqual(lines, []string{"new 2 done"}) {
+		t.Fatalf("unexpected lines: %v", lines)
+	}
+
+	// Rotation: the rest of the old file is read before the new file.
+	appendFile(t, path, "before rotation\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path+".1", "late write\n")
+	appendFile(t, path, "after rotation\n")
+	expected := []string{"before rotation", "late write", "after rotation"}
+	if lines := pollLines(t, tailer); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected %v, but got %v", expected, lines)
+	}
+	if tailer.generation == generation {
+		t.Fatalf("expected the rotation to start a new generation")
+	}
+	generation = tailer.generation
+
+	// Truncation: the file is read from its beginning.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "x\n")
+	if lines := pollLines(t, tailer); !reflect.DeepEqual(lines, []string{"x"}) {
+		t.Fatalf("unexpected lines: %v", lines)
+	}
+	if tailer.generation == generation {
+		t.Fatalf("expected the truncation to start a new generation")
+	}
+}
+
+func TestGatherLogEventsFile(t *testing.T) {
+	logger, err := NewLoggerWithWriter("error", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultClientConfig()
+	config.VswitchdLogFile = filepath.Join(t.TempDir(), "ovs-vswitchd.log")
+	e := NewExporter(WithClientConfig(config), WithLogger(logger))
+	appendFile(t, config.VswitchdLogFile, "2024-01-01T00:00:00.000Z|00001|bridge|INFO|a\n2024-01-01T00:00:00.000Z|00002|bridge|INFO|b\n")
+
+	expect := func(count int, total int) {
+		t.Helper()
+		e.metrics = nil
+		if err := e.gatherLogEvents("ovs-vswitchd"); err != nil {
+			t.Fatalf("expected no error, but got %q", err)
+		}
+		expected, names := "", []string{"ovs_log_events_total"}
+		if count > 0 {
+			names = append(names, "ovs_log_event_count")
+			expected = fmt.Sprintf(`
+# HELP ovs_log_event_count The number of recorded log meessage associated with an OVN component by log severity level and source.
+# TYPE ovs_log_event_count gauge
+ovs_log_event_count{component="ovs-vswitchd",severity="info",source="bridge",system_id="unknown"} %d
+`, count)
+		}
+		expected += fmt.Sprintf(`
+# HELP ovs_log_events_total The total number of log messages associated with an OVN component by log severity level and source read by the exporter. The messages already in a log file when the exporter starts are included.
+# TYPE ovs_log_events_total counter
+ovs_log_events_total{component="ovs-vswitchd",severity="info",source="bridge",system_id="unknown"} %d
+`, total)
+		if err := testutil.CollectAndCompare(e, strings.NewReader(expected), names...); err != nil {
+			t.Fatal(err)
+		}
+		if n := testutil.CollectAndCount(e, "ovs_log_event_count"); count == 0 && n != 0 {
+			t.Fatalf("expected no ovs_log_event_count series, but got %d", n)
+		}
+	}
+
+	// Like before the log files were tailed, the gauge counts the messages
+	// of the whole log file.
+	expect(2, 2)
+	expect(2, 2)
+	appendFile(t, config.VswitchdLogFile, "2024-01-01T00:00:01.000Z|00003|bridge|INFO|c\n")
+	expect(3, 3)
+
+	// The gauge starts over with a new log file, the counter does not.
+	if err := os.Rename(config.VswitchdLogFile, config.VswitchdLogFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, config.VswitchdLogFile, "2024-01-01T00:00:02.000Z|00001|bridge|INFO|d\n")
+	expect(1, 4)
+
+	// After a rotation to an empty file, the gauge reports the empty file
+	// before any new line arrives.
+	if err := os.Rename(config.VswitchdLogFile, config.VswitchdLogFile+".2"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, config.VswitchdLogFile, "")
+	expect(0, 4)
+	appendFile(t, config.VswitchdLogFile, "2024-01-01T00:00:03.000Z|00001|bridge|INFO|e\n")
+	expect(1, 5)
+
+	// The same applies to a truncation in place, e.g. by copytruncate.
+	if err := os.Truncate(config.VswitchdLogFile, 0); err != nil {
+		t.Fatal(err)
+	}
+	expect(0, 5)
+}
+
+func TestParseLogLine(t *testing.T) {
+	entry, ok := parseLogLine("2024-01-01T00:00:00.000Z|00042|bridge|INFO|bridge br-int: added interface a|b")
+	if !ok {
+		t.Fatalf("expected line to be parsed")
+	}
+	expected := logEntry{
+		Timestamp: "2024-01-01T00:00:00.000Z",
+		Sequence:  "00042",
+		Source:    "bridge",
+		Severity:  "info",
+		Message:   "bridge br-int: added interface a|b",
+	}
+	if entry != expected {
+		t.Fatalf("expected %+v, but got %+v", expected, entry)
+	}
+	if _, ok := parseLogLine("garbage"); ok {
+		t.Fatalf("expected garbage not to be parsed")
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	logEventTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "log_events_total"),
+		"The total number of log messages associated with an OVN component by log severity level and source read by the exporter. The messages already in a log file when the exporter starts are included.",
+		[]string{"system_id", "component", "severity", "source"}, nil,
+	)
+)
+
+// logEntry is a message of an OVS log, e.g.
+// "2024-01-01T00:00:00.000Z|00042|bridge|INFO|bridge br-int: added interface".
+type logEntry struct {
+	Timestamp string
+	Sequence  string
+	Source    string
+	Severity  string
+	Message   string
+}
+
+// parseLogLine parses a line of an OVS log file. Invalid UTF-8 is replaced,
+// because the source and severity become label values.
+func parseLogLine(line string) (logEntry, bool) {
+	elements := strings.SplitN(strings.ToValidUTF8(line, "\uFFFD"), "|", 5)
+	if len(elements) < 5 {
+		return logEntry{}, false
+	}
+	return logEntry{
+		Timestamp: elements[0],
+		Sequence:  elements[1],
+		Source:    elements[2],
+		Severity:  strings.ToLower(elements[3]),
+		Message:   elements[4],
+	}, true
+}
+
+// logFilePath returns the path to the log file of a component.
+func (e *Exporter) logFilePath(component string) (string, error) {
+	switch component {
+	case "ovsdb-server":
+		return e.clientConfig.DatabaseLogFile, nil
+	case "ovs-vswitchd":
+		return e.clientConfig.VswitchdLogFile, nil
+	case "ovn-controller":
+		return e.clientConfig.OvnControllerLogFile, nil
+	}
+	return "", fmt.Errorf("The '%s' component is unsupported", component)
+}
+
+// logSource reads the messages appended to the log of a component since
+// the previous poll.
+type logSource interface {
+	// ID identifies the location of the log, e.g. the path of a log file.
+	ID() string
+	Poll(fn func(logEntry)) error
+	Close()
+}
+
+// fileLogSource reads the log file of a component. It counts the messages
+// in the current log file by severity and source, which is what the
+// ovs_log_event_count gauge has always reported.
+type fileLogSource struct {
+	*logTailer
+	generation int
+	counts     map[string]map[string]uint64
+}
+
+// ID implements logSource.
+func (f *fileLogSource) ID() string {
+	return "file:" + f.path
+}
+
+// Poll implements logSource.
+func (f *fileLogSource) Poll(fn func(logEntry)) error {
+	err := f.logTailer.Poll(func(line string) {
+		entry, ok := parseLogLine(line)
+		if !ok {
+			return
+		}
+		// The lines drained from a rotated file are counted before the
+		// tailer opens the new file.
+		f.followGeneration()
+		if _, exists := f.counts[entry.Severity]; !exists {
+			f.counts[entry.Severity] = make(map[string]uint64)
+		}
+		f.counts[entry.Severity][entry.Source]++
+		fn(entry)
+	})
+	// The log file may have been rotated to an empty file, or truncated,
+	// without any new lines.
+	f.followGeneration()
+	return err
+}
+
+// followGeneration starts counting over when the tailer reads a new log
+// file, i.e. after rotation or truncation.
+func (f *fileLogSource) followGeneration() {
+	if f.counts == nil || f.generation != f.logTailer.generation {
+		f.counts = make(map[string]map[string]uint64)
+		f.generation = f.logTailer.generation
+	}
+}
+
+// ID implements logSource.
+func (j *journalReader) ID() string {
+	return "journald:" + j.unit + ":" + j.directory
+}
+
+// defaultJournalUnits are the systemd units of the components, as shipped
+// by the openvswitch and ovn packages.
+var defaultJournalUnits = map[string]string{
+	"ovsdb-server":   "ovsdb-server.service",
+	"ovs-vswitchd":   "ovs-vswitchd.service",
+	"ovn-controller": "ovn-controller.service",
+}
+
+// journalUnit returns the systemd unit of a component.
+func (e *Exporter) journalUnit(component string) (string, error) {
+	if unit, exists := e.journalUnits[component]; exists && unit != "" {
+		return unit, nil
+	}
+	if unit, exists := defaultJournalUnits[component]; exists {
+		return unit, nil
+	}
+	return "", fmt.Errorf("The '%s' component is unsupported", component)
+}
+
+// newLogSource returns the configured log source of a component.
+func (e *Exporter) newLogSource(component string) (logSource, error) {
+	if e.logSource == "journald" {
+		unit, err := e.journalUnit(component)
+		if err != nil {
+			return nil, err
+		}
+		return newJournalReader(unit, e.journalDirectory), nil
+	}
+	path, err := e.logFilePath(component)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLogSource{logTailer: newLogTailer(path)}, nil
+}
+
+// gatherLogEvents reads the messages appended to the log of a component
+// since the previous poll and counts them by severity and source. The
+// ovs_log_event_count gauge is only reported for log files.
+func (e *Exporter) gatherLogEvents(component string) error {
+	source, err := e.newLogSource(component)
+	if err != nil {
+		return err
+	}
+	if e.logSources == nil {
+		e.logSources = make(map[string]logSource)
+	}
+	if e.logEvents == nil {
+		e.logEvents = make(map[string]map[string]map[string]float64)
+	}
+	current, exists := e.logSources[component]
+	if !exists || current.ID() != source.ID() {
+		if exists {
+			current.Close()
+		}
+		e.logSources[component] = source
+	} else {
+		source = current
+	}
+	if _, exists := e.logEvents[component]; !exists {
+		e.logEvents[component] = make(map[string]map[string]float64)
+	}
+	events := e.logEvents[component]
+
+	err = source.Poll(func(entry logEntry) {
+		if _, exists := events[entry.Severity]; !exists {
+			events[entry.Severity] = make(map[string]float64)
+		}
+		events[entry.Severity][entry.Source]++
+		e.matchLogPatterns(component, entry.Message)
+		e.matchPollInterval(component, entry.Message)
+	})
+	e.collectLogPatterns(component)
+	e.collectPollInterval(component)
+
+	for sev, sources := range events {
+		for source, count := range sources {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				logEventTotal,
+				prometheus.CounterValue,
+				count,
+				e.system.ID,
+				component,
+				sev,
+				source,
+			))
+		}
+	}
+	file, isFile := source.(*fileLogSource)
+	if !isFile {
+		return err
+	}
+	for sev, sources := range file.counts {
+		for source, count := range sources {
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				logEventStat,
+				prometheus.GaugeValue,
+				float64(count),
+				e.system.ID,
+				component,
+				sev,
+				source,
+			))
+		}
+	}
+	return err
+}
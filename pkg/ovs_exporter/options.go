@@ -0,0 +1,150 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"log/slog"
+)
+
+// Option configures an Exporter created by NewExporter.
+type Option func(*Exporter)
+
+// WithTimeout sets the timeout of requests to OVS, in seconds. It defaults
+// to 2 seconds.
+func WithTimeout(seconds int) Option {
+	return func(e *Exporter) {
+		e.timeout = seconds
+	}
+}
+
+// WithClientConfig tells the default client where to find OVS. It defaults
+// to DefaultClientConfig.
+func WithClientConfig(config ClientConfig) Option {
+	return func(e *Exporter) {
+		e.clientConfig = config
+	}
+}
+
+// WithClient replaces the default client, e.g. with another backend. The
+// log files are still read from the paths set by WithClientConfig.
+func WithClient(client Client) Option {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// WithLogger sets the logger. It defaults to the default logger of slog.
+func WithLogger(logger slog.Logger) Option {
+	return func(e *Exporter) {
+		e.logger = logger
+	}
+}
+
+// WithProcessMetrics enables or disables the metrics about the OVS daemons,
+// e.g. their process IDs and the coverage, memory and datapath metrics
+// gathered with ovs-appctl. They are enabled by default.
+func WithProcessMetrics(enabled bool) Option {
+	return func(e *Exporter) {
+		e.collectProcessRelatedMetrics = enabled
+	}
+}
+
+// WithDatapathFlows enables the breakdown of datapath flows. Datapaths with
+// more than limit flows are skipped, unless limit is 0.
+func WithDatapathFlows(limit int) Option {
+	return func(e *Exporter) {
+		e.collectDatapathFlows = true
+		e.dpFlowsLimit = limit
+	}
+}
+
+// WithHwOffload enables the hardware offload metrics. The offloaded flows
+// of datapaths with more than limit flows are not counted, unless limit is
+// 0.
+func WithHwOffload(limit int) Option {
+	return func(e *Exporter) {
+		e.collectHwOffload = true
+		e.hwOffloadFlowsLimit = limit
+	}
+}
+
+// WithCoverageFilter limits the coverage events that are exported.
+func WithCoverageFilter(filter *EventFilter) Option {
+	return func(e *Exporter) {
+		e.coverageFilter = filter
+	}
+}
+
+// WithoutCoverageAverages disables the ovs_coverage_avg metric.
+func WithoutCoverageAverages() Option {
+	return func(e *Exporter) {
+		e.skipCoverageAverages = true
+	}
+}
+
+// WithProcessResources enables the procfs metrics of the OVS daemons.
+func WithProcessResources() Option {
+	return func(e *Exporter) {
+		e.collectProcessResources = true
+	}
+}
+
+// WithVswitchdThreads enables the per-thread metrics of ovs-vswitchd.
+func WithVswitchdThreads() Option {
+	return func(e *Exporter) {
+		e.collectVswitchdThreads = true
+	}
+}
+
+// WithProcPath sets the mountpoint of procfs. It defaults to /proc.
+func WithProcPath(path string) Option {
+	return func(e *Exporter) {
+		e.procPath = path
+	}
+}
+
+// WithLogPatternRules sets the patterns counted in the logs of OVS.
+func WithLogPatternRules(rules []*LogPatternRule) Option {
+	return func(e *Exporter) {
+		e.logPatternRules = rules
+	}
+}
+
+// WithJournal reads the logs of OVS from the systemd journal instead of
+// log files. The units map the components, e.g. ovs-vswitchd, to their
+// systemd units. Units missing from the map are set to the default ones.
+// An empty directory selects the system journal.
+func WithJournal(directory string, units map[string]string) Option {
+	return func(e *Exporter) {
+		e.logSource = "journald"
+		e.journalDirectory = directory
+		e.journalUnits = units
+	}
+}
+
+// WithRecordDir saves the responses of OVS to dir, see Exporter.Connect.
+func WithRecordDir(dir string) Option {
+	return func(e *Exporter) {
+		e.recordDir = dir
+	}
+}
+
+// WithReplayDir answers the requests of the exporter from the responses
+// saved to dir by WithRecordDir, instead of OVS.
+func WithReplayDir(dir string) Option {
+	return func(e *Exporter) {
+		e.replayDir = dir
+	}
+}
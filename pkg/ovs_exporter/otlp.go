@@ -0,0 +1,119 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// OTLPConfig holds the configuration of the OTLP metrics export.
+type OTLPConfig struct {
+	// Endpoint is the URL of an OTLP receiver, e.g. http://localhost:4318
+	// for OTLP/HTTP or http://localhost:4317 for OTLP/gRPC. The http scheme
+	// disables TLS.
+	Endpoint string
+	// Protocol is either "grpc" or "http/protobuf".
+	Protocol string
+	// Headers are sent with each export, e.g. for authentication.
+	Headers map[string]string
+	// Interval is the time between exports.
+	Interval time.Duration
+	// Timeout is the timeout of an export.
+	Timeout time.Duration
+}
+
+// otlpResource returns the resource describing the OVS host, built from the
+// labels of ovs_info.
+func (e *Exporter) otlpResource() *resource.Resource {
+	return resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(appName),
+		semconv.ServiceVersion(version.Version),
+		semconv.HostName(e.system.Hostname),
+		attribute.String("ovs.system_id", e.system.ID),
+		attribute.String("ovs.version", e.system.OvsVersion),
+		attribute.String("ovs.db_version", e.system.DbVersion),
+	)
+}
+
+// NewOTLPMeterProvider returns a meter provider periodically exporting the
+// metrics of a gatherer to an OTLP receiver. Counters, gauges, histograms
+// and summaries keep their type; info metrics become gauges. The caller
+// must call Shutdown on the provider to stop it.
+func (e *Exporter) NewOTLPMeterProvider(ctx context.Context, cfg OTLPConfig, g prometheus.Gatherer) (*sdkmetric.MeterProvider, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s: %s", cfg.Endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s: the scheme must be http or https", cfg.Endpoint)
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("the OTLP export interval must be positive")
+	}
+
+	var exporter sdkmetric.Exporter
+	switch cfg.Protocol {
+	case "grpc":
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpointURL(cfg.Endpoint),
+			otlpmetricgrpc.WithHeaders(cfg.Headers),
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, otlpmetricgrpc.WithTimeout(cfg.Timeout))
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+	case "http/protobuf":
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpointURL(cfg.Endpoint),
+			otlpmetrichttp.WithHeaders(cfg.Headers),
+		}
+		if u.Path == "" || u.Path == "/" {
+			opts = append(opts, otlpmetrichttp.WithURLPath("/v1/metrics"))
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, otlpmetrichttp.WithTimeout(cfg.Timeout))
+		}
+		exporter, err = otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %s", cfg.Protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(
+		exporter,
+		sdkmetric.WithInterval(cfg.Interval),
+		sdkmetric.WithProducer(otelprometheus.NewMetricProducer(otelprometheus.WithGatherer(g))),
+	)
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(e.otlpResource()),
+	), nil
+}
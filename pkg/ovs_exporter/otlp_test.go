@@ -0,0 +1,123 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPMeterProvider(t *testing.T) {
+	var mu sync.Mutex
+	requests := []*collectormetrics.ExportMetricsServiceRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &collectormetrics.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithTimeout(2),
+		WithLogger(logger),
+	)
+	exporter.system.ID = "4f6e5a4c-0e62-4a1d-8d4d-1f0c4a1e3b55"
+	exporter.system.Hostname = "hv1"
+	exporter.system.Version = "unknown"
+	exporter.system.OvsVersion = "3.3.0"
+	exporter.system.DbVersion = "8.5.0"
+
+	ctx := context.Background()
+	provider, err := exporter.NewOTLPMeterProvider(ctx, OTLPConfig{
+		Endpoint: server.URL,
+		Protocol: "http/protobuf",
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Interval: time.Hour,
+	}, testRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) == 0 {
+		t.Fatalf("expected an export request")
+	}
+	rm := requests[0].GetResourceMetrics()[0]
+	attributes := map[string]string{}
+	for _, kv := range rm.GetResource().GetAttributes() {
+		attributes[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	expected := map[string]string{
+		"ovs.system_id":  "4f6e5a4c-0e62-4a1d-8d4d-1f0c4a1e3b55",
+		"host.name":      "hv1",
+		"ovs.version":    "3.3.0",
+		"ovs.db_version": "8.5.0",
+		"service.name":   "ovs-exporter",
+	}
+	for k, v := range expected {
+		if attributes[k] != v {
+			t.Fatalf("expected resource attribute %s=%s, but got %v", k, v, attributes)
+		}
+	}
+	metrics := map[string]bool{}
+	for _, sm := range rm.GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			switch m.GetName() {
+			case "ovs_up":
+				metrics[m.GetName()] = m.GetGauge() != nil
+			case "ovs_poll_interval_seconds":
+				metrics[m.GetName()] = m.GetHistogram() != nil
+			}
+		}
+	}
+	if !metrics["ovs_up"] || !metrics["ovs_poll_interval_seconds"] {
+		t.Fatalf("expected a gauge and a histogram, but got %v", metrics)
+	}
+
+	if _, err := exporter.NewOTLPMeterProvider(ctx, OTLPConfig{Endpoint: "localhost:4317", Protocol: "grpc", Interval: time.Minute}, testRegistry()); err == nil {
+		t.Fatalf("expected an endpoint without scheme to be rejected")
+	}
+}
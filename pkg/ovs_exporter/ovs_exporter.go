@@ -16,17 +16,17 @@ package ovs_exporter
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
-	_ "net/http/pprof"
 	"os"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/syseleven/ovsdbclient"
 	"github.com/prometheus/client_golang/prometheus"
-	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/common/version"
+	"github.com/prometheus/procfs"
 )
 
 const (
@@ -324,7 +324,9 @@ var (
 // the prometheus metrics package.
 type Exporter struct {
 	sync.RWMutex
-	Client                       *ovsdbclient.OvsClient
+	client                       Client
+	clientConfig                 ClientConfig
+	system                       SystemInfo
 	timeout                      int
 	pollInterval                 int64
 	errors                       int64
@@ -333,16 +335,38 @@ type Exporter struct {
 	metrics                      []prometheus.Metric
 	logger                       slog.Logger
 	collectProcessRelatedMetrics bool
-}
-
-type Options struct {
-	Timeout                      int
-	Logger                       slog.Logger
-	CollectProcessRelatedMetrics bool
+	collectDatapathFlows         bool
+	dpFlowsLimit                 int
+	dpFlowFirstSeen              map[string]map[string]time.Time
+	collectHwOffload             bool
+	hwOffloadFlowsLimit          int
+	coverageFilter               *EventFilter
+	skipCoverageAverages         bool
+	collectProcessResources      bool
+	procPath                     string
+	collectVswitchdThreads       bool
+	logSource                    string
+	journalDirectory             string
+	journalUnits                 map[string]string
+	logSources                   map[string]logSource
+	logEvents                    map[string]map[string]map[string]float64
+	logPatternRules              []*LogPatternRule
+	logPatternStats              map[string]map[string]*logPatternStat
+	pollIntervalStats            map[string]*pollIntervalStat
+	pollErrors                   map[string][]string
+	health                       pollHealth
+	recordDir                    string
+	replayDir                    string
+	debugSockets                 *debugSockets
 }
 
 // NewLogger returns an instance of logger.
 func NewLogger(logLevel string) (slog.Logger, error) {
+	return NewLoggerWithWriter(logLevel, os.Stdout)
+}
+
+// NewLoggerWithWriter returns an instance of logger writing to w.
+func NewLoggerWithWriter(logLevel string, w io.Writer) (slog.Logger, error) {
 	slogLevel := slog.Level.Level(slog.LevelInfo)
 	error := slogLevel.UnmarshalText([]byte(logLevel))
 	if error != nil {
@@ -350,39 +374,65 @@ func NewLogger(logLevel string) (slog.Logger, error) {
 		return *slog.New(nil), error
 	}
 	logHandlerOptions := slog.HandlerOptions{Level: slogLevel}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &logHandlerOptions))
+	logger := slog.New(slog.NewTextHandler(w, &logHandlerOptions))
 	return *logger, nil
 }
 
-// NewExporter returns an initialized Exporter.
-func NewExporter(opts Options) *Exporter {
+// NewExporter returns an initialized Exporter configured by the given
+// options. It does not register any metrics, see Register and NewServer.
+func NewExporter(options ...Option) *Exporter {
 	version.Version = appVersion
 	version.Revision = gitCommit
 	version.Branch = gitBranch
 	version.BuildUser = buildUser
 	version.BuildDate = buildDate
 	e := Exporter{
-		timeout:                      opts.Timeout,
-		collectProcessRelatedMetrics: opts.CollectProcessRelatedMetrics,
+		timeout:                      2,
+		logger:                       *slog.Default(),
+		collectProcessRelatedMetrics: true,
+		procPath:                     procfs.DefaultMountPoint,
+		clientConfig:                 DefaultClientConfig(),
+	}
+	for _, option := range options {
+		option(&e)
+	}
+	if e.client == nil {
+		e.client = NewClient(e.clientConfig, e.timeout, e.logger)
 	}
-	client := ovsdbclient.NewOvsClient()
-	client.Timeout = opts.Timeout
-	e.Client = client
-	e.logger = *opts.Logger.With("system_id", e.Client.System.ID)
+	e.system = defaultSystemInfo(e.clientConfig)
+	e.health.systemID = e.system.ID
+	e.logger = *e.logger.With("system_id", e.system.ID)
 	return &e
 }
 
+// Connect connects the client to OVS and reads the system information. In
+// record and replay mode, the default client is pointed at the proxies or
+// servers of the mode first.
 func (e *Exporter) Connect() error {
-	e.Client.GetSystemID()
+	if e.replayDir != "" || e.recordDir != "" {
+		if _, ok := e.client.(*ovsClient); !ok {
+			return fmt.Errorf("record and replay mode require the default client")
+		}
+	}
+	if e.replayDir != "" {
+		if err := e.startReplay(e.replayDir); err != nil {
+			return fmt.Errorf("failed replaying %s: %s", e.replayDir, err)
+		}
+	} else if e.recordDir != "" {
+		if err := e.startRecording(e.recordDir); err != nil {
+			return fmt.Errorf("failed recording to %s: %s", e.recordDir, err)
+		}
+	}
+
 	e.logger.Debug("NewExporter() calls Connect()")
 
-	if err := e.Client.Connect(); err != nil {
+	if err := e.client.Connect(); err != nil {
 		return err
 	}
 
 	e.logger.Debug("NewExporter() calls GetSystemInfo()")
 
-	if err := e.Client.GetSystemInfo(); err != nil {
+	if err := e.getSystemInfo(); err != nil {
 		e.logger.Debug("Error occured during GetSystemInfo()", "error", err.Error())
 	}
 
@@ -398,13 +448,30 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- requestErrors
 	ch <- nextPoll
 	ch <- pid
+	ch <- processCPUSeconds
+	ch <- processResidentMemory
+	ch <- processVirtualMemory
+	ch <- processOpenFds
+	ch <- processMaxFds
+	ch <- processThreads
+	ch <- processContextSwitches
+	ch <- processStartTime
+	ch <- vswitchdThreadCPUSeconds
+	ch <- vswitchdThreads
 	ch <- logFileSize
 	ch <- dbFileSize
 	ch <- logEventStat
+	ch <- logEventTotal
+	ch <- logPatternMatches
+	ch <- logPatternValue
+	ch <- pollInterval
+	ch <- pollIntervalCPU
 	ch <- networkPortUp
+	ch <- ovsdbTLSCertExpiry
 	ch <- covAvg
 	ch <- covTotal
 	ch <- memUsage
+	ch <- datapathDrops
 	ch <- dpInterface
 	ch <- dpBridgeInterfaceTotal
 	ch <- dpLookupsHit
@@ -414,6 +481,17 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- dpMasksTotal
 	ch <- dpMasksHitRatio
 	ch <- dpLookupsLost
+	ch <- dpFlowsByInPort
+	ch <- dpFlowsByAction
+	ch <- dpFlowsByOffload
+	ch <- dpFlowIdleSeconds
+	ch <- dpFlowAgeSeconds
+	ch <- dpFlowsDumpTruncated
+	ch <- hwOffloadEnabled
+	ch <- hwOffloadTcPolicy
+	ch <- hwOffloadDpFlows
+	ch <- hwOffloadStats
+	ch <- collectorSuccess
 	ch <- interfaceMain
 	ch <- interfaceAdminState
 	ch <- interfaceLinkState
@@ -474,21 +552,21 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 			info,
 			prometheus.GaugeValue,
 			1,
-			e.Client.System.ID, e.Client.System.RunDir, e.Client.System.Hostname,
-			e.Client.System.Type, e.Client.System.Version,
-			e.Client.Database.Vswitch.Version, e.Client.Database.Vswitch.Schema.Version,
+			e.system.ID, e.systemRunDir(), e.system.Hostname,
+			e.system.Type, e.system.Version,
+			e.system.OvsVersion, e.system.DbVersion,
 		)
 		ch <- prometheus.MustNewConstMetric(
 			requestErrors,
 			prometheus.CounterValue,
 			float64(e.errors),
-			e.Client.System.ID,
+			e.system.ID,
 		)
 		ch <- prometheus.MustNewConstMetric(
 			nextPoll,
 			prometheus.CounterValue,
 			float64(e.nextCollectionTicker),
-			e.Client.System.ID,
+			e.system.ID,
 		)
 		return
 	}
@@ -515,19 +593,20 @@ func (e *Exporter) GatherMetrics() {
 		e.metrics = e.metrics[:0]
 		e.logger.Debug("GatherMetrics() cleared metrics")
 	}
+	e.pollErrors = make(map[string][]string)
 	upValue := 1
 
 	var err error
 
-	err = e.Client.GetSystemInfo()
+	err = e.getSystemInfo()
 	if err != nil {
 		e.logger.Debug("GetSystemInfo() failed",
-					   "vswitch_name", e.Client.Database.Vswitch.Name,
+					   "vswitch_name", e.clientConfig.DatabaseName,
 					   "error", err.Error())
-		e.IncrementErrorCounter()
+		e.collectorFailed("system", "", err)
 		upValue = 0
 	} else {
-		e.logger.Debug("GetSystemInfo() successful", "vswitch_name", e.Client.Database.Vswitch.Name)
+		e.logger.Debug("GetSystemInfo() successful", "vswitch_name", e.clientConfig.DatabaseName)
 	}
 
 	components := []string{
@@ -540,23 +619,39 @@ func (e *Exporter) GatherMetrics() {
 		e.logger.Debug("Didn't call GetProcessInfo() because 'collectProcessRelatedMetrics' is false")
 	}
 	for _, component := range components {
-		p, err := e.Client.GetProcessInfo(component)
+		p, err := e.client.GetProcessInfo(component)
 		e.logger.Debug("GatherMetrics() calls GetProcessInfo()", "component", component)
 		if err != nil {
 			e.logger.Error("GetProcessInfo() failed", "component", component, "error", err.Error())
-			e.IncrementErrorCounter()
+			e.collectorFailed("process", component, err)
 			upValue = 0
 		}
 		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 			pid,
 			prometheus.GaugeValue,
 			float64(p.ID),
-			e.Client.System.ID,
+			e.system.ID,
 			component,
 			p.User,
 			p.Group,
 		))
 		e.logger.Debug("GatherMetrics() completed GetProcessInfo()", "component", component)
+		if e.collectProcessResources && p.ID > 0 {
+			e.logger.Debug("GatherMetrics() calls gatherProcessResources()", "component", component)
+			if err := e.gatherProcessResources(component, p.ID); err != nil {
+				e.logger.Error("gatherProcessResources() failed", "component", component, "error", err.Error())
+				e.collectorFailed("process_resources", component, err)
+			}
+			e.logger.Debug("GatherMetrics() completed gatherProcessResources()", "component", component)
+		}
+		if e.collectVswitchdThreads && component == "ovs-vswitchd" && p.ID > 0 {
+			e.logger.Debug("GatherMetrics() calls gatherVswitchdThreads()", "component", component)
+			if err := e.gatherVswitchdThreads(p.ID); err != nil {
+				e.logger.Error("gatherVswitchdThreads() failed", "component", component, "error", err.Error())
+				e.collectorFailed("vswitchd_threads", component, err)
+			}
+			e.logger.Debug("GatherMetrics() completed gatherVswitchdThreads()", "component", component)
+		}
 	}
 
 	components = []string{
@@ -564,50 +659,40 @@ func (e *Exporter) GatherMetrics() {
 		"ovs-vswitchd",
 		"ovn-controller",
 	}
+	if e.replayDir != "" {
+		// The logs of OVS are not recorded.
+		components = []string{}
+	}
 	for _, component := range components {
-		e.logger.Debug("GatherMetrics() calls GetLogFileInfo()", "component", component)
-
-		file, err := e.Client.GetLogFileInfo(component)
-		if err != nil {
-			e.logger.Error("GetLogFileInfo() failed", "component", component, "error", err.Error())
-			e.IncrementErrorCounter()
-			continue
-		}
-		e.logger.Debug("GatherMetrics() completed GetLogFileInfo()", "component", component)
-
-		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-			logFileSize,
-			prometheus.GaugeValue,
-			float64(file.Info.Size()),
-			e.Client.System.ID,
-			file.Component,
-			file.Path,
-		))
+		if e.logSource != "journald" {
+			e.logger.Debug("GatherMetrics() calls GetLogFileInfo()", "component", component)
 
-		e.logger.Debug("GatherMetrics() calls GetLogFileEventStats()", "component", component)
+			file, err := e.client.GetLogFileInfo(component)
+			if err != nil {
+				e.logger.Error("GetLogFileInfo() failed", "component", component, "error", err.Error())
+				e.collectorFailed("log", component, err)
+				continue
+			}
+			e.logger.Debug("GatherMetrics() completed GetLogFileInfo()", "component", component)
 
-		eventStats, err := e.Client.GetLogFileEventStats(component)
-		if err != nil {
-			e.logger.Error("GetLogFileEventStats() failed", "component", component, "error", err.Error())
-			e.IncrementErrorCounter()
-			continue
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				logFileSize,
+				prometheus.GaugeValue,
+				float64(file.Info.Size()),
+				e.system.ID,
+				file.Component,
+				file.Path,
+			))
 		}
 
-		e.logger.Debug("GatherMetrics() completed GetLogFileEventStats()", "component", component)
+		e.logger.Debug("GatherMetrics() calls gatherLogEvents()", "component", component)
 
-		for sev, sources := range eventStats {
-			for source, count := range sources {
-				e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-					logEventStat,
-					prometheus.GaugeValue,
-					float64(count),
-					e.Client.System.ID,
-					component,
-					sev,
-					source,
-				))
-			}
+		if err := e.gatherLogEvents(component); err != nil {
+			e.logger.Error("gatherLogEvents() failed", "component", component, "error", err.Error())
+			e.collectorFailed("log", component, err)
 		}
+
+		e.logger.Debug("GatherMetrics() completed gatherLogEvents()", "component", component)
 	}
 
 	components = []string{
@@ -624,36 +709,39 @@ func (e *Exporter) GatherMetrics() {
 	for _, component := range components {
 		e.logger.Debug("GatherMetrics() calls AppListCommands()", "component", component)
 
-		if cmds, err := e.Client.AppListCommands(component); err != nil {
+		if cmds, err := e.client.AppListCommands(component); err != nil {
 			e.logger.Error("AppListCommands() failed", "component", component, "error", err.Error())
-			e.IncrementErrorCounter()
+			e.collectorFailed("appctl", component, err)
 			e.logger.Debug("GatherMetrics() completed AppListCommands()", "component", component)
 		} else {
 			e.logger.Debug("GatherMetrics() completed AppListCommands()", "component", component)
 			if cmds["coverage/show"] {
 				e.logger.Debug("GatherMetrics() calls GetAppCoverageMetrics()", "component", component)
 
-				if metrics, err := e.Client.GetAppCoverageMetrics(component); err != nil {
+				if metrics, err := e.client.GetAppCoverageMetrics(component); err != nil {
 					e.logger.Error("GetAppCoverageMetrics() failed", "component", component, "error", err.Error())
-					e.IncrementErrorCounter()
+					e.collectorFailed("coverage", component, err)
 				} else {
 					for event, metric := range metrics {
+						if !e.coverageFilter.Match(event) {
+							continue
+						}
 						for period, value := range metric {
 							if period == "total" {
 								e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 									covTotal,
 									prometheus.CounterValue,
 									value,
-									e.Client.System.ID,
+									e.system.ID,
 									component,
 									event,
 								))
-							} else {
+							} else if !e.skipCoverageAverages {
 								e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 									covAvg,
 									prometheus.GaugeValue,
 									value,
-									e.Client.System.ID,
+									e.system.ID,
 									component,
 									event,
 									period,
@@ -661,21 +749,32 @@ func (e *Exporter) GatherMetrics() {
 							}
 						}
 					}
+					if component == "vswitchd-service" {
+						for reason, value := range getDatapathDrops(metrics) {
+							e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+								datapathDrops,
+								prometheus.CounterValue,
+								value,
+								e.system.ID,
+								reason,
+							))
+						}
+					}
 				}
 				e.logger.Debug("GatherMetrics() completed GetAppCoverageMetrics()", "component", component)
 			}
 			if cmds["memory/show"] && (component != "ovncontroller-service") {
 				e.logger.Debug("GatherMetrics() calls GetAppMemoryMetrics()", "component", component)
-				if metrics, err := e.Client.GetAppMemoryMetrics(component); err != nil {
+				if metrics, err := e.client.GetAppMemoryMetrics(component); err != nil {
 					e.logger.Error("GetAppMemoryMetrics() failed", "component", component, "error", err.Error())
-					e.IncrementErrorCounter()
+					e.collectorFailed("memory", component, err)
 				} else {
 					for facility, value := range metrics {
 						e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 							memUsage,
 							prometheus.GaugeValue,
 							value,
-							e.Client.System.ID,
+							e.system.ID,
 							component,
 							facility,
 						))
@@ -686,9 +785,9 @@ func (e *Exporter) GatherMetrics() {
 			if cmds["dpif/show"] && (component == "vswitchd-service") {
 				e.logger.Debug("GatherMetrics() calls GetAppDatapath()", "component", component)
 
-				if dps, brs, intfs, err := e.Client.GetAppDatapath(component); err != nil {
+				if dps, brs, intfs, err := e.client.GetAppDatapath(component); err != nil {
 					e.logger.Error("GetAppDatapath() failed", "component", component, "error", err.Error())
-					e.IncrementErrorCounter()
+					e.collectorFailed("datapath", component, err)
 				} else {
 					for _, dp := range dps {
 						dpIntefaceCount := 0
@@ -707,12 +806,12 @@ func (e *Exporter) GatherMetrics() {
 									dpInterface,
 									prometheus.GaugeValue,
 									1,
-									e.Client.System.ID,
+									e.system.ID,
 									dp.Name,
 									br.Name,
 									intf.Name,
-									fmt.Sprintf("%0.f", intf.OfPort),
-									fmt.Sprintf("%0.f", intf.Index),
+									strconv.FormatFloat(intf.OfPort, 'f', 0, 64),
+									strconv.FormatFloat(intf.Index, 'f', 0, 64),
 									intf.Type,
 								))
 							}
@@ -721,7 +820,7 @@ func (e *Exporter) GatherMetrics() {
 								dpBridgeInterfaceTotal,
 								prometheus.GaugeValue,
 								float64(brIntefaceCount),
-								e.Client.System.ID,
+								e.system.ID,
 								dp.Name,
 								br.Name,
 							))
@@ -731,21 +830,21 @@ func (e *Exporter) GatherMetrics() {
 							dpLookupsHit,
 							prometheus.CounterValue,
 							dp.Lookups.Hit,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 						e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 							dpLookupsMissed,
 							prometheus.CounterValue,
 							dp.Lookups.Missed,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 						e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 							dpLookupsLost,
 							prometheus.CounterValue,
 							dp.Lookups.Lost,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 						// Add datapath flows
@@ -753,7 +852,7 @@ func (e *Exporter) GatherMetrics() {
 							dpFlowsTotal,
 							prometheus.GaugeValue,
 							dp.Flows,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 						// Add datapath masks
@@ -761,24 +860,31 @@ func (e *Exporter) GatherMetrics() {
 							dpMasksHit,
 							prometheus.CounterValue,
 							dp.Masks.Hit,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 						e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 							dpMasksTotal,
 							prometheus.CounterValue,
 							dp.Masks.Total,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 						e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 							dpMasksHitRatio,
 							prometheus.GaugeValue,
 							dp.Masks.HitRatio,
-							e.Client.System.ID,
+							e.system.ID,
 							dp.Name,
 						))
 					}
+					var dumped map[string]map[string]int
+					if e.collectDatapathFlows {
+						dumped = e.gatherDatapathFlows(dps)
+					}
+					if e.collectHwOffload {
+						e.gatherHwOffload(dps, cmds, dumped)
+					}
 				}
 				e.logger.Debug("GatherMetrics() completed GetAppDatapath()", "component", component)
 			}
@@ -787,317 +893,12 @@ func (e *Exporter) GatherMetrics() {
 
 	e.logger.Debug("GatherMetrics() calls GetDbInterfaces()")
 
-	if intfs, err := e.Client.GetDbInterfaces(); err != nil {
+	if intfs, err := e.client.GetDbInterfaces(); err != nil {
 		e.logger.Error("GetDbInterfaces() failed", "error", err.Error())
-		e.IncrementErrorCounter()
+		e.collectorFailed("interfaces", "", err)
 	} else {
-		for _, intf := range intfs {
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceMain,
-				prometheus.GaugeValue,
-				1,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-				intf.BridgeName,
-			))
-			var adminState float64
-			switch intf.AdminState {
-			case "down":
-				adminState = 0
-			case "up":
-				adminState = 1
-			default:
-				adminState = 2
-			}
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceAdminState,
-				prometheus.GaugeValue,
-				adminState,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			var linkState float64
-			switch intf.LinkState {
-			case "down":
-				linkState = 0
-			case "up":
-				linkState = 1
-			default:
-				linkState = 2
-			}
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceLinkState,
-				prometheus.GaugeValue,
-				linkState,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceIngressPolicingBurst,
-				prometheus.GaugeValue,
-				intf.IngressPolicingBurst,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceIngressPolicingRate,
-				prometheus.GaugeValue,
-				intf.IngressPolicingRate,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceMacInUse,
-				prometheus.GaugeValue,
-				1,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.MacInUse,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceMtu,
-				prometheus.GaugeValue,
-				intf.Mtu,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			var linkDuplex float64
-			switch intf.Duplex {
-			case "half":
-				linkDuplex = 1
-			case "full":
-				linkDuplex = 2
-			default:
-				linkDuplex = 0
-			}
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceDuplex,
-				prometheus.GaugeValue,
-				linkDuplex,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceOfPort,
-				prometheus.GaugeValue,
-				intf.OfPort,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceIfIndex,
-				prometheus.GaugeValue,
-				intf.IfIndex,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceLocalIndex,
-				prometheus.GaugeValue,
-				intf.Index,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			for key, value := range intf.Statistics {
-				switch key {
-				case "rx_crc_err":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxCrcError,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_dropped":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxDropped,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_frame_err":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxFrameError,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_over_err":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxOverrunError,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_errors":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxErrorsTotal,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_packets":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxPackets,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_bytes":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxBytes,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "tx_packets":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatTxPackets,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "tx_bytes":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatTxBytes,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "tx_dropped":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatTxDropped,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "tx_errors":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatTxErrorsTotal,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "collisions":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatCollisions,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_missed_errors":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStatRxMissedErrors,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				case "rx_multicast_packets":
-					e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-						interfaceStateMulticastPackets,
-						prometheus.CounterValue,
-						float64(value),
-						e.Client.System.ID,
-						intf.UUID,
-						intf.Name,
-					))
-				default:
-					e.logger.Debug("detected malformed interface statistics",
-								   "key", key,
-								   "value", value,
-								   "error", "OVS interface statistics has unsupported key",
-					)
-				}
-			}
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceLinkResets,
-				prometheus.CounterValue,
-				intf.LinkResets,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-				interfaceLinkSpeed,
-				prometheus.GaugeValue,
-				intf.LinkSpeed,
-				e.Client.System.ID,
-				intf.UUID,
-				intf.Name,
-			))
-			for key, value := range intf.Status {
-				e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-					interfaceStatusKeyValuePair,
-					prometheus.GaugeValue,
-					1,
-					e.Client.System.ID,
-					intf.UUID,
-					key,
-					value,
-					intf.Name,
-				))
-			}
-			for key, value := range intf.Options {
-				e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-					interfaceOptionsKeyValuePair,
-					prometheus.GaugeValue,
-					1,
-					e.Client.System.ID,
-					intf.UUID,
-					key,
-					value,
-					intf.Name,
-				))
-			}
-			for key, value := range intf.ExternalIDs {
-				e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
-					interfaceExternalIdKeyValuePair,
-					prometheus.GaugeValue,
-					1,
-					e.Client.System.ID,
-					intf.UUID,
-					key,
-					value,
-					intf.Name,
-				))
-			}
-		}
+		e.gatherInterfaceMetrics(intfs)
+		e.gatherInterfaceDrops(intfs)
 	}
 
 	e.logger.Debug("GatherMetrics() completed GetDbInterfaces()")
@@ -1108,38 +909,47 @@ func (e *Exporter) GatherMetrics() {
 
 	for _, component := range components {
 		e.logger.Debug("GatherMetrics() calls IsDefaultPortUp()", "component", component)
-		defaultPortUp, err := e.Client.IsDefaultPortUp(component)
+		defaultPortUp, err := e.client.IsDefaultPortUp(component)
 		if err != nil {
 			e.logger.Error("IsDefaultPortUp() failed", "component", component, "error", err.Error())
-			e.IncrementErrorCounter()
+			e.collectorFailed("network_port", component, err)
 		}
 		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 			networkPortUp,
 			prometheus.GaugeValue,
 			float64(defaultPortUp),
-			e.Client.System.ID,
+			e.system.ID,
 			component,
 			"default",
 		))
 		e.logger.Debug("GatherMetrics() completed IsDefaultPortUp()", "component", component)
 
 		e.logger.Debug("GatherMetrics() calls IsSslPortUp()", "component", component)
-		sslPortUp, err := e.Client.IsSslPortUp(component)
+		sslPortUp, err := e.client.IsSslPortUp(component)
 		if err != nil {
 			e.logger.Error("IsSslPortUp() failed", "component", component, "error", err.Error())
-			e.IncrementErrorCounter()
+			e.collectorFailed("network_port", component, err)
 		}
 		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 			networkPortUp,
 			prometheus.GaugeValue,
 			float64(sslPortUp),
-			e.Client.System.ID,
+			e.system.ID,
 			component,
 			"ssl",
 		))
 		e.logger.Debug("GatherMetrics() completed IsSslPortUp()", "component", component)
 	}
 
+	if isSslRemote(e.clientConfig.DatabaseRemote) {
+		e.logger.Debug("GatherMetrics() calls gatherOvsdbTLSCertExpiry()")
+		if err := e.gatherOvsdbTLSCertExpiry(); err != nil {
+			e.logger.Error("gatherOvsdbTLSCertExpiry() failed", "error", err.Error())
+			e.collectorFailed("tls", "", err)
+		}
+		e.logger.Debug("GatherMetrics() completed gatherOvsdbTLSCertExpiry()")
+	}
+
 	if e.collectProcessRelatedMetrics {
 		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 			up,
@@ -1152,34 +962,34 @@ func (e *Exporter) GatherMetrics() {
 		info,
 		prometheus.GaugeValue,
 		1,
-		e.Client.System.ID, e.Client.System.RunDir, e.Client.System.Hostname,
-		e.Client.System.Type, e.Client.System.Version,
-		e.Client.Database.Vswitch.Version, e.Client.Database.Vswitch.Schema.Version,
+		e.system.ID, e.systemRunDir(), e.system.Hostname,
+		e.system.Type, e.system.Version,
+		e.system.OvsVersion, e.system.DbVersion,
 	))
 
 	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 		requestErrors,
 		prometheus.CounterValue,
 		float64(e.errors),
-		e.Client.System.ID,
+		e.system.ID,
 	))
 
 	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
 		nextPoll,
 		prometheus.CounterValue,
 		float64(e.nextCollectionTicker),
-		e.Client.System.ID,
+		e.system.ID,
 	))
 
+	e.gatherCollectorStatus()
+
+	e.setPollHealth()
+	e.saveRecording()
 	e.nextCollectionTicker = time.Now().Add(time.Duration(e.pollInterval) * time.Second).Unix()
 
 	e.logger.Debug("GatherMetrics() returns")
 }
 
-func init() {
-	prometheus.MustRegister(versioncollector.NewCollector(namespace + "_exporter"))
-}
-
 // GetVersionInfo returns exporter info.
 func GetVersionInfo() string {
 	return version.Info()
@@ -1205,6 +1015,14 @@ func GetExporterName() string {
 	return appName
 }
 
+// SystemInfo returns the system information read from OVS by the last
+// poll.
+func (e *Exporter) SystemInfo() SystemInfo {
+	e.RLock()
+	defer e.RUnlock()
+	return e.system
+}
+
 // SetPollInterval sets exporter's polling interval.
 func (e *Exporter) SetPollInterval(i int64) {
 	e.pollInterval = i
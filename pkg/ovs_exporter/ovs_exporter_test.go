@@ -15,101 +15,118 @@
 package ovs_exporter
 
 import (
-	"io/ioutil"
-	"net"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNewExporter(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+
 	logger, err := NewLogger("debug")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	opts := Options{
-		Timeout: 2,
-		Logger:  logger,
-	}
-
-	exporter := NewExporter(opts)
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+	)
 	if err := exporter.Connect(); err != nil {
 		t.Fatalf("expected no error, but got %q", err)
 	}
 
-	exporter.Client.System.RunDir = "/var/run/openvswitch"
-	exporter.Client.Database.Vswitch.Name = "Open_vSwitch"
-	exporter.Client.Database.Vswitch.Socket.Remote = "unix:/var/run/openvswitch/db.sock"
-	exporter.Client.Database.Vswitch.File.Data.Path = "/etc/openvswitch/conf.db"
-	exporter.Client.Database.Vswitch.File.Log.Path = "/var/log/openvswitch/ovsdb-server.log"
-	exporter.Client.Database.Vswitch.File.Pid.Path = "/var/run/openvswitch/ovsdb-server.pid"
-	exporter.Client.Database.Vswitch.File.SystemID.Path = "/etc/openvswitch/system-id.conf"
-
-	exporter.Client.Service.Vswitchd.File.Log.Path = "/var/log/openvswitch/ovs-vswitchd.log"
-	exporter.Client.Service.Vswitchd.File.Pid.Path = "/var/run/openvswitch/ovs-vswitchd.pid"
-
-	exporter.Client.Service.OvnController.File.Log.Path = "/var/log/openvswitch/ovn-controller.log"
-	exporter.Client.Service.OvnController.File.Pid.Path = "/var/run/openvswitch/ovn-controller.pid"
-
 	exporter.SetPollInterval(int64(15))
-	prometheus.MustRegister(exporter)
-	metricsPath := "/metrics"
-	http.Handle(metricsPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-             <head><title>OVS Exporter</title></head>
-             <body>
-             <h1>OVS Exporter</h1>
-             <p><a href='` + metricsPath + `'>Metrics</a></p>
-             </body>
-             </html>`))
-	})
-
-	go func() {
-		http.ListenAndServe(":9475", nil)
-	}()
-
-	time.Sleep(1 * time.Second)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+	server := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer server.Close()
 
-	tr := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 10 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 10 * time.Second,
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("%s", err)
 	}
+	defer res.Body.Close()
 
-	httpClient := &http.Client{
-		Transport: tr,
-		Timeout:   time.Second * 30,
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("non-EOF error: %s", err)
 	}
 
-	var req *http.Request
-	req, err = http.NewRequest("GET", "http://127.0.0.1:9475/metrics", nil)
-	if err != nil {
-		t.Fatalf("%s", err)
+	if len(exporter.pollErrors) > 0 {
+		t.Fatalf("expected no collector to fail, but got %v", exporter.pollErrors)
+	}
+	expected := []string{
+		`ovs_up 1`,
+		`hostname="hv1",ovs_version="2.17.9"`,
+		`ovs_coverage_total{component="vswitchd-service",event="xlate_actions",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 137562`,
+		`ovs_memory_usage{component="ovsdb-server",facility="cells",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 2512`,
+		`ovs_dp_lookups_hit{datapath="system@ovs-system",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 182317`,
+		`ovs_dp_br_if_total{bridge="br-int",datapath="system@ovs-system",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 4`,
+		`ovs_interface{bridge_name="br-int",name="tap0",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",uuid="9e3f2a1b-7c6d-4e8f-9a0b-3c4d5e6f7a02"} 1`,
+		`ovs_interface_rx_packets{name="eth1",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01",uuid="9e3f2a1b-7c6d-4e8f-9a0b-3c4d5e6f7a06"} 702113`,
 	}
+	for _, s := range expected {
+		if !strings.Contains(string(body), s) {
+			t.Errorf("expected %q in the scrape", s)
+		}
+	}
+	if t.Failed() {
+		t.Logf("%s", string(body))
+	}
+}
 
-	res, err := httpClient.Do(req)
+func TestGatherMetricsAllCollectors(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+
+	logger, err := NewLogger("info")
 	if err != nil {
-		if !strings.HasSuffix(err.Error(), "EOF") {
-			t.Fatalf("%s", err)
-		}
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+		WithDatapathFlows(0),
+		WithHwOffload(0),
+		WithProcessResources(),
+		WithVswitchdThreads(),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
 	}
+	exporter.SetPollInterval(15)
+	exporter.GatherMetrics()
 
-	if res == nil {
-		t.Fatalf("response: <nil>")
+	status, ready := exporter.Health(3)
+	if !ready {
+		t.Fatalf("expected the exporter to be ready, but got %+v", status)
+	}
+	for _, c := range status.Collectors {
+		if c.Status != "ok" {
+			t.Errorf("expected the %s collector to succeed, but got %v", c.Name, c.Errors)
+		}
 	}
-	defer res.Body.Close()
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		t.Fatalf("non-EOF error: %s", err)
+	for _, name := range []string{
+		"ovs_dp_flows_by_in_port",
+		"ovs_hw_offload_enabled",
+		"ovs_hw_offload_dp_flows",
+		"ovs_hw_offload_stats",
+		"ovs_process_cpu_seconds_total",
+		"ovs_vswitchd_threads",
+		"ovs_datapath_drops_total",
+	} {
+		if n := testutil.CollectAndCount(exporter, name); n == 0 {
+			t.Errorf("expected %s to be collected", name)
+		}
 	}
 
-	t.Logf("%s", string(body))
 }
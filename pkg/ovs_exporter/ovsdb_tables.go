@@ -0,0 +1,173 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+
+	"github.com/syseleven/ovsdbclient"
+)
+
+// ovsdbString returns a string column of a row, or an empty string.
+func ovsdbString(row ovsdbclient.Row, column string, columns map[string]string) string {
+	if _, exists := row[column]; !exists {
+		return ""
+	}
+	data, dataType, err := row.GetColumnValue(column, columns)
+	if err != nil || dataType != "string" {
+		return ""
+	}
+	return data.(string)
+}
+
+// ovsdbStrings returns a set of strings or UUIDs of a row.
+func ovsdbStrings(row ovsdbclient.Row, column string, columns map[string]string) []string {
+	if _, exists := row[column]; !exists {
+		return nil
+	}
+	data, dataType, err := row.GetColumnValue(column, columns)
+	if err != nil {
+		return nil
+	}
+	switch dataType {
+	case "[]string":
+		return data.([]string)
+	case "string":
+		return []string{data.(string)}
+	}
+	return nil
+}
+
+// ovsdbStringMap returns a map of strings of a row.
+func ovsdbStringMap(row ovsdbclient.Row, column string, columns map[string]string) map[string]string {
+	if _, exists := row[column]; exists {
+		data, dataType, err := row.GetColumnValue(column, columns)
+		if err == nil && dataType == "map[string]string" {
+			return data.(map[string]string)
+		}
+	}
+	return map[string]string{}
+}
+
+// ovsdbIntegers returns an integer or a set of integers of a row, e.g. 100
+// or ["set", [100, 200]].
+func ovsdbIntegers(row ovsdbclient.Row, column string) []int64 {
+	switch v := row[column].(type) {
+	case float64:
+		return []int64{int64(v)}
+	case []interface{}:
+		if len(v) != 2 || v[0] != "set" {
+			return nil
+		}
+		elements, ok := v[1].([]interface{})
+		if !ok {
+			return nil
+		}
+		values := []int64{}
+		for _, element := range elements {
+			if f, ok := element.(float64); ok {
+				values = append(values, int64(f))
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// ovsdbInteger returns an integer column of a row, or 0 when the column is
+// empty, e.g. the ofport of an interface that failed to be created.
+func ovsdbInteger(row ovsdbclient.Row, column string) float64 {
+	if v, ok := row[column].(float64); ok {
+		return v
+	}
+	return 0
+}
+
+// GetDbBridges returns the bridges of the Bridge table.
+func (c *ovsClient) GetDbBridges() ([]*Bridge, error) {
+	c.Lock()
+	defer c.Unlock()
+	query := "SELECT _uuid, name, ports, datapath_type, fail_mode, external_ids FROM Bridge"
+	result, err := c.transact(query)
+	if err != nil {
+		return nil, fmt.Errorf("the '%s' query failed: %s", query, err)
+	}
+	bridges := make([]*Bridge, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		bridges = append(bridges, &Bridge{
+			UUID:         ovsdbString(row, "_uuid", result.Columns),
+			Name:         ovsdbString(row, "name", result.Columns),
+			DatapathType: ovsdbString(row, "datapath_type", result.Columns),
+			FailMode:     ovsdbString(row, "fail_mode", result.Columns),
+			ExternalIDs:  ovsdbStringMap(row, "external_ids", result.Columns),
+			Ports:        ovsdbStrings(row, "ports", result.Columns),
+		})
+	}
+	return bridges, nil
+}
+
+// GetDbPorts returns the ports of the Port table.
+func (c *ovsClient) GetDbPorts() ([]*Port, error) {
+	c.Lock()
+	defer c.Unlock()
+	query := "SELECT _uuid, name, interfaces, tag, trunks, vlan_mode, external_ids FROM Port"
+	result, err := c.transact(query)
+	if err != nil {
+		return nil, fmt.Errorf("the '%s' query failed: %s", query, err)
+	}
+	ports := make([]*Port, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		port := &Port{
+			UUID:        ovsdbString(row, "_uuid", result.Columns),
+			Name:        ovsdbString(row, "name", result.Columns),
+			Interfaces:  ovsdbStrings(row, "interfaces", result.Columns),
+			Trunks:      ovsdbIntegers(row, "trunks"),
+			VlanMode:    ovsdbString(row, "vlan_mode", result.Columns),
+			ExternalIDs: ovsdbStringMap(row, "external_ids", result.Columns),
+		}
+		if tag := ovsdbIntegers(row, "tag"); len(tag) == 1 {
+			port.Tag = &tag[0]
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// GetDbOtherConfig returns the other_config column of the Open_vSwitch
+// table.
+func (c *ovsClient) GetDbOtherConfig() (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	query := fmt.Sprintf("SELECT other_config FROM %s", c.config.DatabaseName)
+	result, err := c.transact(query)
+	if err != nil {
+		return nil, fmt.Errorf("the '%s' query failed: %s", query, err)
+	}
+	if len(result.Rows) == 0 {
+		return nil, fmt.Errorf("the '%s' query did not return any rows", query)
+	}
+	data, dataType, err := result.Rows[0].GetColumnValue("other_config", result.Columns)
+	if err != nil {
+		return nil, fmt.Errorf("parsing 'other_config' failed: %s", err)
+	}
+	switch dataType {
+	case "map[string]string":
+		return data.(map[string]string), nil
+	case "[]string":
+		// An empty map is reported as an empty set.
+		return map[string]string{}, nil
+	}
+	return nil, fmt.Errorf("data type '%s' for 'other_config' column is unexpected in this context", dataType)
+}
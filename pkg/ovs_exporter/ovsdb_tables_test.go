@@ -0,0 +1,71 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestGetDbPorts(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	fake.setRows("Port", []map[string]interface{}{
+		{
+			"_uuid":        []interface{}{"uuid", "5d7a1f0e-0000-0000-0000-000000000001"},
+			"name":         "tap0",
+			"interfaces":   []interface{}{"uuid", "9e3f2a1b-0000-0000-0000-000000000001"},
+			"tag":          100,
+			"external_ids": []interface{}{"map", []interface{}{[]interface{}{"iface-id", "vm1"}}},
+		},
+		{
+			"_uuid": []interface{}{"uuid", "5d7a1f0e-0000-0000-0000-000000000002"},
+			"name":  "bond0",
+			"interfaces": []interface{}{"set", []interface{}{
+				[]interface{}{"uuid", "9e3f2a1b-0000-0000-0000-000000000002"},
+				[]interface{}{"uuid", "9e3f2a1b-0000-0000-0000-000000000003"},
+			}},
+			"trunks":    []interface{}{"set", []interface{}{10, 20}},
+			"vlan_mode": "trunk",
+		},
+	})
+	client := NewClient(fake.config(), 2, *slog.Default())
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ports, err := client.GetDbPorts()
+	if err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	found := map[string]*Port{}
+	for _, port := range ports {
+		found[port.Name] = port
+	}
+	tap, bond := found["tap0"], found["bond0"]
+	if len(ports) != 2 || tap == nil || bond == nil {
+		t.Fatalf("unexpected ports: %+v", ports)
+	}
+	if tap.Tag == nil || *tap.Tag != 100 || len(tap.Trunks) != 0 || tap.ExternalIDs["iface-id"] != "vm1" {
+		t.Fatalf("unexpected VM port: %+v", tap)
+	}
+	if !reflect.DeepEqual(tap.Interfaces, []string{"9e3f2a1b-0000-0000-0000-000000000001"}) {
+		t.Fatalf("unexpected interfaces of the VM port: %v", tap.Interfaces)
+	}
+	if bond.Tag != nil || !reflect.DeepEqual(bond.Trunks, []int64{10, 20}) || bond.VlanMode != "trunk" || len(bond.Interfaces) != 2 {
+		t.Fatalf("unexpected bond port: %+v", bond)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ovsdbTLSCertExpiry = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "ovsdb", "tls_cert_expiry_seconds"),
+		"The time at which a certificate used to connect to an ssl: remote of OVSDB expires, in seconds since the epoch. The values of type are: certificate, ca_cert.",
+		[]string{"system_id", "type", "subject", "serial"}, nil,
+	)
+)
+
+// tlsReloadInterval is the interval at which the tunnel checks whether the
+// private key or the certificates changed.
+var tlsReloadInterval = 30 * time.Second
+
+// isSslRemote returns true for remotes of the form ssl:host:port.
+func isSslRemote(remote string) bool {
+	return strings.HasPrefix(remote, "ssl:")
+}
+
+// loadOvsdbTLSConfig reads the private key, the certificate and the CA
+// certificates of an ssl: remote. Like ovsdb-client, the certificate of
+// the server is verified against the CA certificates, but its name is not,
+// as the certificates of OVSDB managers rarely carry their host names.
+func loadOvsdbTLSConfig(config ClientConfig) (*tls.Config, error) {
+	if config.PrivateKeyFile == "" || config.CertificateFile == "" || config.CACertFile == "" {
+		return nil, fmt.Errorf("ssl remotes require a private key, a certificate and a CA certificate")
+	}
+	cert, err := tls.LoadX509KeyPair(config.CertificateFile, config.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(config.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", config.CACertFile)
+	}
+	return &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, 0, len(rawCerts))
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+			if len(certs) == 0 {
+				return fmt.Errorf("the server sent no certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+			return err
+		},
+	}, nil
+}
+
+// tlsTunnel connects the client to an ssl: remote of OVSDB. ovsdbclient
+// only dials unix and TCP sockets, so the client talks to a unix socket of
+// the tunnel, which forwards each connection over TLS. The private key and
+// the certificates are read on each connection. When they change, e.g.
+// after a renewal, the open connections are closed, so that the client
+// reconnects with the new certificate.
+type tlsTunnel struct {
+	sync.Mutex
+	address  string
+	config   ClientConfig
+	timeout  time.Duration
+	dir      string
+	listener net.Listener
+	conns    map[net.Conn]bool
+	versions map[string]string
+	done     chan struct{}
+	wg       sync.WaitGroup
+	logger   slog.Logger
+}
+
+// newTLSTunnel starts a tunnel to an ssl: remote. It fails when the
+// private key or the certificates cannot be read, or when the TLS handshake
+// with the remote fails.
+func newTLSTunnel(config ClientConfig, timeout int, logger slog.Logger) (*tlsTunnel, error) {
+	tlsConfig, err := loadOvsdbTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if timeout < 1 {
+		timeout = 2
+	}
+	address := strings.TrimPrefix(config.DatabaseRemote, "ssl:")
+	dialer := &net.Dialer{Timeout: time.Duration(timeout) * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	dir, err := os.MkdirTemp("", "ovs-exporter")
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "db.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	t := &tlsTunnel{
+		address:  address,
+		config:   config,
+		timeout:  time.Duration(timeout) * time.Second,
+		dir:      dir,
+		listener: l,
+		conns:    make(map[net.Conn]bool),
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+	t.versions = t.fileVersions()
+	t.wg.Add(2)
+	go t.accept()
+	go t.watch()
+	return t, nil
+}
+
+// remote returns the socket for the client.
+func (t *tlsTunnel) remote() string {
+	return "unix:" + t.listener.Addr().String()
+}
+
+func (t *tlsTunnel) accept() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !t.track(conn) {
+			conn.Close()
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.untrack(conn)
+			defer conn.Close()
+			t.forward(conn)
+		}()
+	}
+}
+
+// forward connects a connection of the client to the remote.
+func (t *tlsTunnel) forward(conn net.Conn) {
+	config, err := loadOvsdbTLSConfig(t.config)
+	if err != nil {
+		t.logger.Error("failed loading OVSDB certificates", "remote", t.config.DatabaseRemote, "error", err.Error())
+		return
+	}
+	dialer := &net.Dialer{Timeout: t.timeout}
+	server, err := tls.DialWithDialer(dialer, "tcp", t.address, config)
+	if err != nil {
+		t.logger.Error("failed connecting to OVSDB", "remote", t.config.DatabaseRemote, "error", err.Error())
+		return
+	}
+	if !t.track(server) {
+		server.Close()
+		return
+	}
+	defer t.untrack(server)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(server, conn)
+		server.Close()
+	}()
+	io.Copy(conn, server)
+	conn.Close()
+	<-done
+}
+
+// watch closes the open connections when the private key or the
+// certificates change.
+func (t *tlsTunnel) watch() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(tlsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+		versions := t.fileVersions()
+		changed := len(versions) != len(t.versions)
+		for path, version := range versions {
+			if t.versions[path] != version {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		t.versions = versions
+		t.logger.Info("reloading OVSDB certificates", "remote", t.config.DatabaseRemote)
+		t.Lock()
+		for conn := range t.conns {
+			conn.Close()
+		}
+		t.Unlock()
+	}
+}
+
+// fileVersions returns the modification times and sizes of the private
+// key and the certificates.
+func (t *tlsTunnel) fileVersions() map[string]string {
+	versions := make(map[string]string)
+	for _, path := range []string{t.config.PrivateKeyFile, t.config.CertificateFile, t.config.CACertFile} {
+		if info, err := os.Stat(path); err == nil {
+			versions[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return versions
+}
+
+// track registers a connection to be closed by close. It returns false
+// when the tunnel is closed already.
+func (t *tlsTunnel) track(conn net.Conn) bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.conns == nil {
+		return false
+	}
+	t.conns[conn] = true
+	return true
+}
+
+func (t *tlsTunnel) untrack(conn net.Conn) {
+	t.Lock()
+	defer t.Unlock()
+	if t.conns != nil {
+		delete(t.conns, conn)
+	}
+}
+
+// close stops the tunnel and closes its connections.
+func (t *tlsTunnel) close() {
+	t.listener.Close()
+	close(t.done)
+	t.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.conns = nil
+	t.Unlock()
+	t.wg.Wait()
+	os.RemoveAll(t.dir)
+}
+
+// gatherOvsdbTLSCertExpiry exports the expiry of the certificate and the
+// CA certificates of an ssl: remote. The certificates are told apart by
+// their serial numbers, because a CA bundle holds two CA certificates with
+// the same subject during a CA rollover. A certificate found twice in a
+// file is exported once.
+func (e *Exporter) gatherOvsdbTLSCertExpiry() error {
+	files := []struct {
+		kind string
+		path string
+	}{
+		{"certificate", e.clientConfig.CertificateFile},
+		{"ca_cert", e.clientConfig.CACertFile},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		certs, err := readCertificates(file.path)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(certs))
+		for _, cert := range certs {
+			subject, serial := cert.Subject.String(), cert.SerialNumber.String()
+			if seen[subject+"/"+serial] {
+				continue
+			}
+			seen[subject+"/"+serial] = true
+			e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+				ovsdbTLSCertExpiry,
+				prometheus.GaugeValue,
+				float64(cert.NotAfter.Unix()),
+				e.system.ID,
+				file.kind,
+				subject,
+				serial,
+			))
+		}
+	}
+	return nil
+}
+
+// readCertificates returns the certificates of a PEM file.
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing %s: %s", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return certs, nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testCert is a certificate and its private key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert returns a certificate signed by parent, or a self-signed CA
+// certificate when parent is nil.
+func newTestCert(t *testing.T, name string, serial int64, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the certificate and its private key to PEM files.
+func (c *testCert) write(t *testing.T, certPath string, keyPath string) {
+	t.Helper()
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if keyPath == "" {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTLSRemote starts an ssl: remote requiring client certificates signed
+// by ca, which forwards the connections to the OVSDB of the fake. It
+// returns the remote and the serial numbers of the client certificates of
+// its connections.
+func newTLSRemote(t *testing.T, fake *fakeOVS, ca *testCert) (string, func() []string) {
+	t.Helper()
+	server := newTestCert(t, "ovsdb-server", 2, time.Now().Add(24*time.Hour), ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var mu sync.Mutex
+	serials := []string{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tlsConn := conn.(*tls.Conn)
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				mu.Lock()
+				serials = append(serials, tlsConn.ConnectionState().PeerCertificates[0].SerialNumber.String())
+				mu.Unlock()
+				upstream, err := net.Dial("unix", filepath.Join(fake.dir, "db.sock"))
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return "ssl:" + l.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, serials...)
+	}
+}
+
+func TestOvsdbTLS(t *testing.T) {
+	defer func(interval time.Duration) { tlsReloadInterval = interval }(tlsReloadInterval)
+	tlsReloadInterval = 50 * time.Millisecond
+
+	logger, err := NewLoggerWithWriter("error", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeOVS(t, "2.17")
+	notAfter := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	ca := newTestCert(t, "ovs-pki", 1, notAfter.Add(24*time.Hour), nil)
+	remote, serials := newTLSRemote(t, fake, ca)
+
+	dir := t.TempDir()
+	config := fake.config()
+	config.DatabaseRemote = remote
+	config.PrivateKeyFile = filepath.Join(dir, "privkey.pem")
+	config.CertificateFile = filepath.Join(dir, "cert.pem")
+	config.CACertFile = filepath.Join(dir, "cacert.pem")
+	ca.write(t, config.CACertFile, "")
+	newTestCert(t, "ovs-exporter", 10, notAfter, ca).write(t, config.CertificateFile, config.PrivateKeyFile)
+
+	// The CA is being rolled over, so the CA bundle holds the next CA
+	// certificate with the same subject too.
+	next := newTestCert(t, "ovs-pki", 3, notAfter.Add(48*time.Hour), nil)
+	bundle, err := os.ReadFile(config.CACertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: next.der})...)
+	if err := os.WriteFile(config.CACertFile, bundle, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := NewExporter(WithClientConfig(config), WithTimeout(2), WithLogger(logger))
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(exporter)
+
+	systemID := "4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"
+	expected := fmt.Sprintf(`
+# HELP ovs_up Is OVN stack up (1) or is it down (0).
+# TYPE ovs_up gauge
+ovs_up 1
+# HELP ovs_ovsdb_tls_cert_expiry_seconds The time at which a certificate used to connect to an ssl: remote of OVSDB expires, in seconds since the epoch. The values of type are: certificate, ca_cert.
+# TYPE ovs_ovsdb_tls_cert_expiry_seconds gauge
+ovs_ovsdb_tls_cert_expiry_seconds{serial="10",subject="CN=ovs-exporter",system_id="%s",type="certificate"} %d
+ovs_ovsdb_tls_cert_expiry_seconds{serial="1",subject="CN=ovs-pki",system_id="%s",type="ca_cert"} %d
+ovs_ovsdb_tls_cert_expiry_seconds{serial="3",subject="CN=ovs-pki",system_id="%s",type="ca_cert"} %d
+`, systemID, notAfter.Unix(), systemID, notAfter.Add(24*time.Hour).Unix(), systemID, notAfter.Add(48*time.Hour).Unix())
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"ovs_up", "ovs_ovsdb_tls_cert_expiry_seconds"); err != nil {
+		t.Fatal(err)
+	}
+
+	// After the renewal of the certificate, the exporter reconnects with the
+	// new one.
+	newTestCert(t, "ovs-exporter", 11, notAfter.Add(time.Hour), ca).write(t, config.CertificateFile, config.PrivateKeyFile)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exporter.nextCollectionTicker = 0
+		exporter.GatherMetrics()
+		if s := serials(); s[len(s)-1] == "11" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a connection with the renewed certificate, but got %v", serials())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	exporter.nextCollectionTicker = 0
+	expected = `
+# HELP ovs_up Is OVN stack up (1) or is it down (0).
+# TYPE ovs_up gauge
+ovs_up 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "ovs_up"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOvsdbTLSErrors(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	ca := newTestCert(t, "ovs-pki", 1, time.Now().Add(time.Hour), nil)
+	other := newTestCert(t, "other-pki", 1, time.Now().Add(time.Hour), nil)
+	remote, _ := newTLSRemote(t, fake, ca)
+
+	dir := t.TempDir()
+	config := fake.config()
+	config.DatabaseRemote = remote
+	config.PrivateKeyFile = filepath.Join(dir, "privkey.pem")
+	config.CertificateFile = filepath.Join(dir, "cert.pem")
+	config.CACertFile = filepath.Join(dir, "cacert.pem")
+
+	for _, test := range []struct {
+		name  string
+		setup func()
+	}{
+		{"missing files", func() {}},
+		{"unknown server CA", func() {
+			other.write(t, config.CACertFile, "")
+			newTestCert(t, "ovs-exporter", 10, time.Now().Add(time.Hour), ca).write(t, config.CertificateFile, config.PrivateKeyFile)
+		}},
+	} {
+		test.setup()
+		exporter := NewExporter(WithClientConfig(config))
+		if err := exporter.Connect(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		exporter.Close()
+	}
+}
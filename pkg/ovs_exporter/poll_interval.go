@@ -0,0 +1,141 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// OVS Poll Loop
+	// Reference: lib/timeval.c
+	pollInterval = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "poll_interval_seconds"),
+		"The duration of main loop iterations of an OVN component that exceeded one second, parsed from 'Unreasonably long poll interval' log warnings.",
+		[]string{"system_id", "component"}, nil,
+	)
+	pollIntervalCPU = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "poll_interval_cpu_seconds_total"),
+		"The CPU time spent by an OVN component in user and system mode during main loop iterations that exceeded one second.",
+		[]string{"system_id", "component", "mode"}, nil,
+	)
+)
+
+var pollIntervalBuckets = []float64{1, 1.5, 2, 3, 5, 10, 30, 60}
+
+// pollIntervalPattern matches, e.g., "Unreasonably long 2843ms poll interval
+// (1520ms user, 1100ms system)".
+var pollIntervalPattern = regexp.MustCompile(`Unreasonably long (\d+)ms poll interval \((\d+)ms user, (\d+)ms system\)`)
+
+// pollIntervalStat holds the long poll intervals of a component.
+type pollIntervalStat struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+	user    float64
+	system  float64
+}
+
+// parsePollInterval returns the total, user and system time in seconds from
+// an "Unreasonably long poll interval" log message.
+func parsePollInterval(message string) (float64, float64, float64, bool) {
+	if !strings.Contains(message, "Unreasonably long") {
+		return 0, 0, 0, false
+	}
+	m := pollIntervalPattern.FindStringSubmatch(message)
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	values := make([]float64, 3)
+	for i := range values {
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		values[i] = v / 1000
+	}
+	return values[0], values[1], values[2], true
+}
+
+func (e *Exporter) pollIntervalStat(component string) *pollIntervalStat {
+	if e.pollIntervalStats == nil {
+		e.pollIntervalStats = make(map[string]*pollIntervalStat)
+	}
+	stat, exists := e.pollIntervalStats[component]
+	if !exists {
+		stat = &pollIntervalStat{buckets: make(map[float64]uint64, len(pollIntervalBuckets))}
+		for _, b := range pollIntervalBuckets {
+			stat.buckets[b] = 0
+		}
+		e.pollIntervalStats[component] = stat
+	}
+	return stat
+}
+
+// matchPollInterval records a log message of a component, when it reports a
+// long poll interval.
+func (e *Exporter) matchPollInterval(component string, message string) {
+	total, user, system, ok := parsePollInterval(message)
+	if !ok {
+		return
+	}
+	stat := e.pollIntervalStat(component)
+	stat.count++
+	stat.sum += total
+	stat.user += user
+	stat.system += system
+	for _, b := range pollIntervalBuckets {
+		if total <= b {
+			stat.buckets[b]++
+		}
+	}
+}
+
+// collectPollInterval exports the long poll intervals of a component.
+func (e *Exporter) collectPollInterval(component string) {
+	stat := e.pollIntervalStat(component)
+	buckets := make(map[float64]uint64, len(stat.buckets))
+	for b, c := range stat.buckets {
+		buckets[b] = c
+	}
+	e.metrics = append(e.metrics, prometheus.MustNewConstHistogram(
+		pollInterval,
+		stat.count,
+		stat.sum,
+		buckets,
+		e.system.ID,
+		component,
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		pollIntervalCPU,
+		prometheus.CounterValue,
+		stat.user,
+		e.system.ID,
+		component,
+		"user",
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		pollIntervalCPU,
+		prometheus.CounterValue,
+		stat.system,
+		e.system.ID,
+		component,
+		"system",
+	))
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"testing"
+)
+
+func TestParsePollInterval(t *testing.T) {
+	total, user, system, ok := parsePollInterval("Unreasonably long 2843ms poll interval (1520ms user, 1100ms system)")
+	if !ok {
+		t.Fatalf("expected message to be parsed")
+	}
+	if total != 2.843 || user != 1.52 || system != 1.1 {
+		t.Fatalf("unexpected values: %v %v %v", total, user, system)
+	}
+	for _, m := range []string{
+		"faults: 1583 minor, 0 major",
+		"Unreasonably long poll interval",
+		"bridge br-int: added interface",
+	} {
+		if _, _, _, ok := parsePollInterval(m); ok {
+			t.Errorf("expected %q not to be parsed", m)
+		}
+	}
+}
+
+func TestMatchPollInterval(t *testing.T) {
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithTimeout(2),
+		WithLogger(logger),
+	)
+	exporter.matchPollInterval("ovn-controller", "Unreasonably long 1200ms poll interval (1000ms user, 10ms system)")
+	exporter.matchPollInterval("ovn-controller", "Unreasonably long 4000ms poll interval (3000ms user, 500ms system)")
+	exporter.matchPollInterval("ovn-controller", "connection dropped")
+
+	stat := exporter.pollIntervalStats["ovn-controller"]
+	if stat.count != 2 || stat.sum != 5.2 || stat.user != 4 || stat.system != 0.51 {
+		t.Fatalf("unexpected stats: %+v", stat)
+	}
+	if stat.buckets[1] != 0 || stat.buckets[1.5] != 1 || stat.buckets[5] != 2 {
+		t.Fatalf("unexpected buckets: %v", stat.buckets)
+	}
+
+	exporter.collectPollInterval("ovs-vswitchd")
+	if len(exporter.metrics) != 3 {
+		t.Fatalf("expected 3 metrics, but got %d", len(exporter.metrics))
+	}
+}
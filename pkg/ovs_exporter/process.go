@@ -0,0 +1,179 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// userHZ is the number of clock ticks per second in /proc/<pid>/stat. It is
+// 100 on all architectures supported by Linux, which procfs relies on too.
+const userHZ = 100
+
+var (
+	// OVS Process Resources
+	// Reference: https://man7.org/linux/man-pages/man5/proc.5.html
+	processCPUSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "cpu_seconds_total"),
+		"The CPU time spent by an OVN component in user and system mode.",
+		[]string{"system_id", "component", "mode"}, nil,
+	)
+	processResidentMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "resident_memory_bytes"),
+		"The resident memory size (RSS) of an OVN component in bytes.",
+		[]string{"system_id", "component"}, nil,
+	)
+	processVirtualMemory = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "virtual_memory_bytes"),
+		"The virtual memory size (VSZ) of an OVN component in bytes.",
+		[]string{"system_id", "component"}, nil,
+	)
+	processOpenFds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "open_fds"),
+		"The number of open file descriptors of an OVN component.",
+		[]string{"system_id", "component"}, nil,
+	)
+	processMaxFds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "max_fds"),
+		"The limit of open file descriptors of an OVN component.",
+		[]string{"system_id", "component"}, nil,
+	)
+	processThreads = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "threads"),
+		"The number of threads of an OVN component.",
+		[]string{"system_id", "component"}, nil,
+	)
+	processContextSwitches = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "context_switches_total"),
+		"The number of context switches of an OVN component. The values of type are: voluntary, nonvoluntary.",
+		[]string{"system_id", "component", "type"}, nil,
+	)
+	processStartTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "process", "start_time_seconds"),
+		"The start time of an OVN component since unix epoch in seconds. A change indicates a restart of the component, which resets its counters.",
+		[]string{"system_id", "component"}, nil,
+	)
+)
+
+// gatherProcessResources collects resource usage of a process from procfs.
+func (e *Exporter) gatherProcessResources(component string, pid int) error {
+	fs, err := procfs.NewFS(e.procPath)
+	if err != nil {
+		return err
+	}
+	proc, err := fs.Proc(pid)
+	if err != nil {
+		return err
+	}
+	stat, err := proc.Stat()
+	if err != nil {
+		return fmt.Errorf("failed reading stat of pid %d: %s", pid, err)
+	}
+	status, err := proc.NewStatus()
+	if err != nil {
+		return fmt.Errorf("failed reading status of pid %d: %s", pid, err)
+	}
+	fds, err := proc.FileDescriptorsLen()
+	if err != nil {
+		return fmt.Errorf("failed reading file descriptors of pid %d: %s", pid, err)
+	}
+	limits, err := proc.Limits()
+	if err != nil {
+		return fmt.Errorf("failed reading limits of pid %d: %s", pid, err)
+	}
+	startTime, err := stat.StartTime()
+	if err != nil {
+		return fmt.Errorf("failed reading start time of pid %d: %s", pid, err)
+	}
+
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processCPUSeconds,
+		prometheus.CounterValue,
+		float64(stat.UTime)/userHZ,
+		e.system.ID,
+		component,
+		"user",
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processCPUSeconds,
+		prometheus.CounterValue,
+		float64(stat.STime)/userHZ,
+		e.system.ID,
+		component,
+		"system",
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processResidentMemory,
+		prometheus.GaugeValue,
+		float64(stat.ResidentMemory()),
+		e.system.ID,
+		component,
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processVirtualMemory,
+		prometheus.GaugeValue,
+		float64(stat.VirtualMemory()),
+		e.system.ID,
+		component,
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processOpenFds,
+		prometheus.GaugeValue,
+		float64(fds),
+		e.system.ID,
+		component,
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processMaxFds,
+		prometheus.GaugeValue,
+		float64(limits.OpenFiles),
+		e.system.ID,
+		component,
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processThreads,
+		prometheus.GaugeValue,
+		float64(stat.NumThreads),
+		e.system.ID,
+		component,
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processContextSwitches,
+		prometheus.CounterValue,
+		float64(status.VoluntaryCtxtSwitches),
+		e.system.ID,
+		component,
+		"voluntary",
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processContextSwitches,
+		prometheus.CounterValue,
+		float64(status.NonVoluntaryCtxtSwitches),
+		e.system.ID,
+		component,
+		"nonvoluntary",
+	))
+	e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+		processStartTime,
+		prometheus.GaugeValue,
+		startTime,
+		e.system.ID,
+		component,
+	))
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGatherProcessResources(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("procfs is not available")
+	}
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithTimeout(2),
+		WithLogger(logger),
+		WithProcessResources(),
+	)
+	if err := exporter.gatherProcessResources("ovs-vswitchd", os.Getpid()); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if len(exporter.metrics) != 10 {
+		t.Fatalf("expected 10 metrics, but got %d", len(exporter.metrics))
+	}
+	if err := exporter.gatherProcessResources("ovs-vswitchd", 0x7ffffffe); err == nil {
+		t.Fatalf("expected an error for a missing process")
+	}
+}
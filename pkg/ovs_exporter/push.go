@@ -0,0 +1,311 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const maxPushBackoff = 30 * time.Second
+
+// PushConfig holds the configuration of the push mode.
+type PushConfig struct {
+	// GatewayURL is the URL of a Pushgateway.
+	GatewayURL string
+	// RemoteWriteURL is the URL of a Prometheus remote-write endpoint.
+	RemoteWriteURL string
+	// Job and Instance group the metrics in the Pushgateway and are added
+	// as labels to remote-write series.
+	Job      string
+	Instance string
+	// Interval is the time between pushes.
+	Interval time.Duration
+	// Retries is the number of times a failed push is retried, waiting
+	// RetryBackoff before the first retry and twice as long before each
+	// following one.
+	Retries      int
+	RetryBackoff time.Duration
+	// HTTPClientConfig holds the basic authentication and TLS settings.
+	HTTPClientConfig config.HTTPClientConfig
+}
+
+// Pusher periodically pushes gathered metrics to a Pushgateway and/or a
+// remote-write endpoint.
+type Pusher struct {
+	config   PushConfig
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	logger   slog.Logger
+	sleep    func(time.Duration)
+}
+
+// permanentError is a push error that is not retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// NewPusher returns a Pusher of the metrics of a gatherer.
+func NewPusher(cfg PushConfig, g prometheus.Gatherer, logger slog.Logger) (*Pusher, error) {
+	if cfg.GatewayURL == "" && cfg.RemoteWriteURL == "" {
+		return nil, fmt.Errorf("neither a Pushgateway nor a remote-write URL is configured")
+	}
+	if cfg.Job == "" {
+		return nil, fmt.Errorf("the push job name is empty")
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("the push interval must be positive")
+	}
+	if err := cfg.HTTPClientConfig.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := config.NewClientFromConfig(cfg.HTTPClientConfig, appName)
+	if err != nil {
+		return nil, err
+	}
+	return &Pusher{
+		config:   cfg,
+		gatherer: g,
+		client:   client,
+		logger:   logger,
+		sleep:    time.Sleep,
+	}, nil
+}
+
+// Run pushes metrics every interval until the context is cancelled.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Push(); err != nil {
+			p.logger.Error("push failed", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push gathers metrics once and pushes them to the configured targets.
+func (p *Pusher) Push() error {
+	mfs, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if p.config.GatewayURL != "" {
+		if err := p.retry("pushgateway", func() error { return p.pushGateway(mfs) }); err != nil {
+			errs = append(errs, fmt.Errorf("pushgateway: %w", err))
+		}
+	}
+	if p.config.RemoteWriteURL != "" {
+		body := encodeRemoteWrite(mfs, p.externalLabels(), time.Now().UnixMilli())
+		if err := p.retry("remote-write", func() error { return p.remoteWrite(body) }); err != nil {
+			errs = append(errs, fmt.Errorf("remote-write: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pusher) retry(target string, fn func() error) error {
+	backoff := p.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt >= p.config.Retries {
+			return err
+		}
+		p.logger.Warn("push failed, retrying", "target", target, "attempt", attempt+1, "backoff", backoff, "error", err.Error())
+		p.sleep(backoff)
+		backoff *= 2
+		if backoff > maxPushBackoff {
+			backoff = maxPushBackoff
+		}
+	}
+}
+
+func (p *Pusher) pushGateway(mfs []*dto.MetricFamily) error {
+	pusher := push.New(p.config.GatewayURL, p.config.Job).
+		Client(p.client).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil }))
+	if p.config.Instance != "" {
+		pusher = pusher.Grouping("instance", p.config.Instance)
+	}
+	return pusher.Push()
+}
+
+func (p *Pusher) remoteWrite(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.config.RemoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", appName)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	// Client errors other than rate limiting fail again on retry.
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// externalLabels returns the labels added to remote-write series.
+func (p *Pusher) externalLabels() map[string]string {
+	labels := map[string]string{"job": p.config.Job}
+	if p.config.Instance != "" {
+		labels["instance"] = p.config.Instance
+	}
+	return labels
+}
+
+// remoteWriteSample is a sample of a remote-write time series.
+type remoteWriteSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// remoteWriteSamples flattens metric families into samples, expanding
+// histograms and summaries into their _bucket, _sum and _count series.
+func remoteWriteSamples(mfs []*dto.MetricFamily, external map[string]string) []remoteWriteSample {
+	samples := []remoteWriteSample{}
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel())+len(external)+2)
+			for k, v := range external {
+				labels[k] = v
+			}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			add := func(suffix string, value float64, extra ...string) {
+				l := make(map[string]string, len(labels)+2)
+				for k, v := range labels {
+					l[k] = v
+				}
+				l["__name__"] = name + suffix
+				for i := 0; i+1 < len(extra); i += 2 {
+					l[extra[i]] = extra[i+1]
+				}
+				samples = append(samples, remoteWriteSample{labels: l, value: value})
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						continue
+					}
+					add("_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				add("_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeRemoteWrite returns a snappy-compressed prometheus.WriteRequest
+// protobuf message with the samples of the metric families.
+//
+// Reference: https://prometheus.io/docs/concepts/remote_write_spec/
+func encodeRemoteWrite(mfs []*dto.MetricFamily, external map[string]string, timestamp int64) []byte {
+	var req []byte
+	for _, s := range remoteWriteSamples(mfs, external) {
+		names := make([]string, 0, len(s.labels))
+		for k := range s.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var ts []byte
+		for _, k := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, k)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.labels[k])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return s2.EncodeSnappy(nil, req)
+}
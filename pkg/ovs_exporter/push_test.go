@@ -0,0 +1,220 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeRemoteWrite decodes a snappy-compressed prometheus.WriteRequest
+// into "name{label="value",...} value" strings.
+func decodeRemoteWrite(t *testing.T, body []byte) []string {
+	t.Helper()
+	data, err := s2.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(b []byte) (protowire.Number, protowire.Type, []byte, uint64, []byte) {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag")
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			return num, typ, v, 0, b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			return num, typ, nil, v, b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			return num, typ, nil, v, b[n:]
+		}
+		t.Fatalf("unexpected wire type %v", typ)
+		return 0, 0, nil, 0, nil
+	}
+	series := []string{}
+	for len(data) > 0 {
+		var ts []byte
+		_, _, ts, _, data = next(data)
+		name := ""
+		labels := []string{}
+		value := 0.0
+		for len(ts) > 0 {
+			var num protowire.Number
+			var msg []byte
+			num, _, msg, _, ts = next(ts)
+			if num == 1 {
+				var k, v []byte
+				_, _, k, _, msg = next(msg)
+				_, _, v, _, _ = next(msg)
+				if string(k) == "__name__" {
+					name = string(v)
+				} else {
+					labels = append(labels, string(k)+"=\""+string(v)+"\"")
+				}
+				continue
+			}
+			var bits, timestamp uint64
+			_, _, _, bits, msg = next(msg)
+			_, _, _, timestamp, _ = next(msg)
+			if timestamp != 1000 {
+				t.Fatalf("expected timestamp 1000, but got %d", timestamp)
+			}
+			value = math.Float64frombits(bits)
+		}
+		series = append(series, name+"{"+strings.Join(labels, ",")+"} "+formatFloat(value))
+	}
+	sort.Strings(series)
+	return series
+}
+
+func testRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ovs_up", Help: "Is OVS stack up (1) or is it down (0)."})
+	up.Set(1)
+	poll := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ovs_poll_interval_seconds",
+		Help:    "The duration of long main loop iterations.",
+		Buckets: []float64{1, 2},
+	}, []string{"component"})
+	poll.WithLabelValues("ovs-vswitchd").Observe(1.5)
+	registry.MustRegister(up, poll)
+	return registry
+}
+
+func TestEncodeRemoteWrite(t *testing.T) {
+	mfs, err := testRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := encodeRemoteWrite(mfs, map[string]string{"job": "ovs", "instance": "hv1"}, 1000)
+	expected := []string{
+		`ovs_poll_interval_seconds_bucket{component="ovs-vswitchd",instance="hv1",job="ovs",le="+Inf"} 1`,
+		`ovs_poll_interval_seconds_bucket{component="ovs-vswitchd",instance="hv1",job="ovs",le="1"} 0`,
+		`ovs_poll_interval_seconds_bucket{component="ovs-vswitchd",instance="hv1",job="ovs",le="2"} 1`,
+		`ovs_poll_interval_seconds_count{component="ovs-vswitchd",instance="hv1",job="ovs"} 1`,
+		`ovs_poll_interval_seconds_sum{component="ovs-vswitchd",instance="hv1",job="ovs"} 1.5`,
+		`ovs_up{instance="hv1",job="ovs"} 1`,
+	}
+	series := decodeRemoteWrite(t, body)
+	if strings.Join(series, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(series, "\n"))
+	}
+}
+
+func TestPusher(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.Method+" "+r.URL.Path]++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ovs" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/api/v1/write":
+			if r.Header.Get("Content-Encoding") != "snappy" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if _, err := s2.Decode(nil, body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		case "/metrics/job/ovs/instance/hv1":
+			if !strings.Contains(r.Header.Get("Content-Type"), "application/vnd.google.protobuf") || len(body) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := PushConfig{
+		GatewayURL:     server.URL,
+		RemoteWriteURL: server.URL + "/api/v1/write",
+		Job:            "ovs",
+		Instance:       "hv1",
+		Interval:       time.Minute,
+		Retries:        3,
+		RetryBackoff:   time.Second,
+		HTTPClientConfig: config.HTTPClientConfig{
+			BasicAuth: &config.BasicAuth{Username: "ovs", Password: "secret"},
+		},
+	}
+	pusher, err := NewPusher(cfg, testRegistry(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backoffs := []time.Duration{}
+	pusher.sleep = func(d time.Duration) { backoffs = append(backoffs, d) }
+
+	if err := pusher.Push(); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if requests["PUT /metrics/job/ovs/instance/hv1"] != 1 {
+		t.Fatalf("expected one push to the Pushgateway, but got %v", requests)
+	}
+	if requests["POST /api/v1/write"] != 3 {
+		t.Fatalf("expected three remote-write requests, but got %v", requests)
+	}
+	if len(backoffs) != 2 || backoffs[0] != time.Second || backoffs[1] != 2*time.Second {
+		t.Fatalf("unexpected backoffs: %v", backoffs)
+	}
+
+	// Client errors are not retried.
+	cfg.HTTPClientConfig.BasicAuth.Password = "wrong"
+	cfg.GatewayURL = ""
+	pusher, err = NewPusher(cfg, testRegistry(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pusher.sleep = func(time.Duration) { t.Fatalf("expected no retry") }
+	if err := pusher.Push(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected an unauthorized error, but got %v", err)
+	}
+}
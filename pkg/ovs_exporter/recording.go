@@ -0,0 +1,590 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+// In record mode, the exporter talks to ovsdb-server and to the control
+// sockets of the OVS daemons through proxies, which save the raw JSON-RPC
+// responses to a directory. In replay mode, the exporter talks to servers
+// answering from such a directory instead, so that the output of OVS on
+// one host can be fed to another build of the exporter on another host.
+//
+// A recording directory holds system-id.conf, db.sock.json with the
+// exchanges with ovsdb-server, and ovs/<daemon>.json and ovn/<daemon>.json
+// with the exchanges with the control sockets in the OVS and OVN run
+// directories. Only the latest response to a request is kept. The
+// responses are written to the directory once per poll.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/syseleven/ovsdbclient"
+)
+
+// replayDaemons are the daemons whose pid files are created in replay mode.
+var replayDaemons = []string{"ovsdb-server", "ovs-vswitchd", "ovn-controller"}
+
+// jsonrpcMessage is a JSON-RPC request or response.
+type jsonrpcMessage struct {
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// recordedExchange is a request and the raw response to it.
+type recordedExchange struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// recording holds the exchanges on a socket, keyed by the method and the
+// parameters of the request.
+type recording struct {
+	sync.Mutex
+	path      string
+	exchanges map[string]recordedExchange
+	changed   bool
+}
+
+// recordingKey returns the key of a request in a recording.
+func recordingKey(msg jsonrpcMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, msg.Params); err != nil {
+		return msg.Method + " " + string(msg.Params)
+	}
+	return msg.Method + " " + b.String()
+}
+
+// loadRecording reads a recording from a file.
+func loadRecording(path string) (*recording, error) {
+	r := &recording{
+		path:      path,
+		exchanges: make(map[string]recordedExchange),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var exchanges []recordedExchange
+	if err := json.Unmarshal(data, &exchanges); err != nil {
+		return nil, fmt.Errorf("failed parsing %s: %s", path, err)
+	}
+	for _, exchange := range exchanges {
+		var req jsonrpcMessage
+		if err := json.Unmarshal(exchange.Request, &req); err != nil {
+			return nil, fmt.Errorf("failed parsing %s: %s", path, err)
+		}
+		r.exchanges[recordingKey(req)] = exchange
+	}
+	return r, nil
+}
+
+// add saves a response to a request, replacing an earlier response to the
+// same request. The recording is written to its file by save.
+func (r *recording) add(req json.RawMessage, resp json.RawMessage) error {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(req, &msg); err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.exchanges[recordingKey(msg)] = recordedExchange{Request: req, Response: resp}
+	r.changed = true
+	return nil
+}
+
+// save writes the recording to its file, when a response was added since
+// the last save.
+func (r *recording) save() error {
+	r.Lock()
+	defer r.Unlock()
+	if !r.changed {
+		return nil
+	}
+	keys := make([]string, 0, len(r.exchanges))
+	for key := range r.exchanges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	exchanges := make([]recordedExchange, 0, len(keys))
+	for _, key := range keys {
+		exchanges = append(exchanges, r.exchanges[key])
+	}
+	data, err := json.MarshalIndent(exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return err
+	}
+	r.changed = false
+	return nil
+}
+
+// response returns the recorded response to a request, with the ID of the
+// request. Echo requests are answered without a recording.
+func (r *recording) response(req jsonrpcMessage) ([]byte, error) {
+	id := req.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if req.Method == "echo" {
+		params := req.Params
+		if params == nil {
+			params = json.RawMessage("[]")
+		}
+		return json.Marshal(map[string]json.RawMessage{"id": id, "result": params, "error": json.RawMessage("null")})
+	}
+	r.Lock()
+	exchange, exists := r.exchanges[recordingKey(req)]
+	r.Unlock()
+	if !exists {
+		msg, _ := json.Marshal(fmt.Sprintf("the '%s' request was not recorded", req.Method))
+		return json.Marshal(map[string]json.RawMessage{"id": id, "result": json.RawMessage("null"), "error": msg})
+	}
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(exchange.Response, &resp); err != nil {
+		return nil, err
+	}
+	resp["id"] = id
+	return json.Marshal(resp)
+}
+
+// debugSockets are the sockets the exporter talks to instead of the ones of
+// OVS in record and replay mode. They are created in a temporary directory,
+// because unix socket paths are limited to 108 bytes.
+type debugSockets struct {
+	sync.Mutex
+	dir        string
+	socketDir  string
+	replay     bool
+	runDir     string
+	runDirs    map[string]string
+	recordings map[string]*recording
+	listeners  map[string]net.Listener
+	conns      map[net.Conn]bool
+	wg         sync.WaitGroup
+	logger     slog.Logger
+}
+
+func newDebugSockets(dir string, replay bool, logger slog.Logger) (*debugSockets, error) {
+	socketDir, err := os.MkdirTemp("", "ovs-exporter")
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"ovs", "ovn"} {
+		if err := os.MkdirAll(filepath.Join(socketDir, sub), 0755); err != nil {
+			os.RemoveAll(socketDir)
+			return nil, err
+		}
+	}
+	s := &debugSockets{
+		dir:        dir,
+		socketDir:  socketDir,
+		replay:     replay,
+		runDirs:    make(map[string]string),
+		recordings: make(map[string]*recording),
+		listeners:  make(map[string]net.Listener),
+		conns:      make(map[net.Conn]bool),
+		logger:     logger,
+	}
+	return s, nil
+}
+
+// startRecording puts proxies between the exporter and OVS, which save
+// the responses of OVS to dir.
+func (e *Exporter) startRecording(dir string) error {
+	if isSslRemote(e.clientConfig.DatabaseRemote) {
+		return fmt.Errorf("ssl remotes cannot be recorded")
+	}
+	for _, sub := range []string{"ovs", "ovn"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	if data, err := os.ReadFile(e.clientConfig.SystemIDFile); err != nil {
+		e.logger.Warn("failed recording system id", "error", err.Error())
+	} else if err := os.WriteFile(filepath.Join(dir, "system-id.conf"), data, 0644); err != nil {
+		return err
+	}
+	s, err := newDebugSockets(dir, false, e.logger)
+	if err != nil {
+		return err
+	}
+	s.runDir = e.clientConfig.RunDir
+	s.runDirs["ovs"] = e.clientConfig.RunDir
+	s.runDirs["ovn"] = e.clientConfig.RunDirOvn
+
+	s.Lock()
+	defer s.Unlock()
+	remote := e.clientConfig.DatabaseRemote
+	rec := s.recording("db.sock")
+	if err := s.listen("db.sock", func(conn net.Conn) { s.proxy(conn, remote, rec) }); err != nil {
+		s.close()
+		return err
+	}
+	e.clientConfig.DatabaseRemote = "unix:" + filepath.Join(s.socketDir, "db.sock")
+	e.clientConfig.RunDir = filepath.Join(s.socketDir, "ovs")
+	e.clientConfig.RunDirOvn = filepath.Join(s.socketDir, "ovn")
+	s.syncControlSockets()
+	e.client = NewClient(e.clientConfig, e.timeout, e.logger)
+	e.debugSockets = s
+	e.logger.Info("recording OVS responses", "dir", dir)
+	return nil
+}
+
+// startReplay points the exporter at servers answering from the recordings
+// in dir instead of OVS. The pid files of the daemons point at the exporter
+// itself. Neither /proc nor the logs of OVS are recorded, so the process
+// resource, ovs-vswitchd thread and log collectors are disabled.
+func (e *Exporter) startReplay(dir string) error {
+	s, err := newDebugSockets(dir, true, e.logger)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	rec, err := loadRecording(filepath.Join(dir, "db.sock.json"))
+	if err != nil {
+		s.close()
+		return err
+	}
+	if err := s.listen("db.sock", func(conn net.Conn) { s.serveRecording(conn, rec) }); err != nil {
+		s.close()
+		return err
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	for _, sub := range []string{"ovs", "ovn"} {
+		paths, _ := filepath.Glob(filepath.Join(dir, sub, "*.json"))
+		for _, path := range paths {
+			daemon := strings.TrimSuffix(filepath.Base(path), ".json")
+			rec, err := loadRecording(path)
+			if err != nil {
+				s.close()
+				return err
+			}
+			name := filepath.Join(sub, daemon+"."+pid+".ctl")
+			if err := s.listen(name, func(conn net.Conn) { s.serveRecording(conn, rec) }); err != nil {
+				s.close()
+				return err
+			}
+		}
+	}
+	for _, daemon := range replayDaemons {
+		if err := os.WriteFile(filepath.Join(s.socketDir, daemon+".pid"), []byte(pid+"\n"), 0644); err != nil {
+			s.close()
+			return err
+		}
+	}
+
+	e.clientConfig.RunDir = filepath.Join(s.socketDir, "ovs")
+	e.clientConfig.RunDirOvn = filepath.Join(s.socketDir, "ovn")
+	e.clientConfig.DatabaseRemote = "unix:" + filepath.Join(s.socketDir, "db.sock")
+	e.clientConfig.SystemIDFile = filepath.Join(dir, "system-id.conf")
+	e.clientConfig.DatabasePidFile = filepath.Join(s.socketDir, "ovsdb-server.pid")
+	e.clientConfig.VswitchdPidFile = filepath.Join(s.socketDir, "ovs-vswitchd.pid")
+	e.clientConfig.OvnControllerPidFile = filepath.Join(s.socketDir, "ovn-controller.pid")
+	e.client = NewClient(e.clientConfig, e.timeout, e.logger)
+	e.collectProcessResources = false
+	e.collectVswitchdThreads = false
+	e.debugSockets = s
+	e.logger.Info("replaying OVS responses", "dir", dir)
+	return nil
+}
+
+// getSystemInfo reads the system information from OVSDB. The run
+// directory found in OVSDB is kept for the ovs_info metric, but in record
+// and replay mode the client keeps talking to the control sockets of the
+// proxies or replay servers.
+func (e *Exporter) getSystemInfo() error {
+	system, err := e.client.GetSystemInfo()
+	e.system = system
+	if c, ok := e.client.(*ovsClient); ok && e.debugSockets != nil {
+		c.Lock()
+		e.debugSockets.pin(c.cli)
+		c.Unlock()
+	}
+	return err
+}
+
+// systemRunDir returns the OVS run directory reported by ovs_info.
+func (e *Exporter) systemRunDir() string {
+	if e.debugSockets != nil {
+		e.debugSockets.Lock()
+		defer e.debugSockets.Unlock()
+		return e.debugSockets.runDir
+	}
+	return e.system.RunDir
+}
+
+// saveRecording writes the responses recorded since the last poll to the
+// record directory.
+func (e *Exporter) saveRecording() {
+	if e.debugSockets == nil || e.debugSockets.replay {
+		return
+	}
+	e.debugSockets.Lock()
+	defer e.debugSockets.Unlock()
+	for _, rec := range e.debugSockets.recordings {
+		if err := rec.save(); err != nil {
+			e.logger.Warn("failed recording OVS responses", "file", rec.path, "error", err.Error())
+		}
+	}
+}
+
+// Close closes the connection to OVSDB and stops the proxies or servers of
+// record and replay mode.
+func (e *Exporter) Close() {
+	e.client.Close()
+	if e.debugSockets != nil {
+		e.saveRecording()
+		e.debugSockets.Lock()
+		e.debugSockets.close()
+		e.debugSockets.Unlock()
+		e.debugSockets = nil
+	}
+}
+
+// pin points the client back at the run directory of the sockets after the
+// run directory was read from OVSDB.
+func (s *debugSockets) pin(cli *ovsdbclient.OvsClient) {
+	s.Lock()
+	defer s.Unlock()
+	runDir := filepath.Join(s.socketDir, "ovs")
+	if cli.System.RunDir != runDir {
+		s.runDir = cli.System.RunDir
+		if !s.replay {
+			s.runDirs["ovs"] = cli.System.RunDir
+		}
+		cli.System.RunDir = runDir
+	}
+	if !s.replay {
+		s.syncControlSockets()
+	}
+}
+
+// recording returns the recording of a socket, creating it when needed.
+func (s *debugSockets) recording(name string) *recording {
+	if rec, exists := s.recordings[name]; exists {
+		return rec
+	}
+	rec := &recording{
+		path:      filepath.Join(s.dir, name+".json"),
+		exchanges: make(map[string]recordedExchange),
+	}
+	s.recordings[name] = rec
+	return rec
+}
+
+// syncControlSockets creates a proxy for each control socket in the OVS
+// and OVN run directories, and removes the proxies of control sockets that
+// are gone, e.g. after a daemon was restarted. The recording of a daemon is
+// shared by its control sockets, whose names embed the process ID.
+func (s *debugSockets) syncControlSockets() {
+	for sub, runDir := range s.runDirs {
+		paths, _ := filepath.Glob(filepath.Join(runDir, "*.ctl"))
+		found := make(map[string]bool)
+		for _, path := range paths {
+			name := filepath.Join(sub, filepath.Base(path))
+			found[name] = true
+			if _, exists := s.listeners[name]; exists {
+				continue
+			}
+			daemon := strings.SplitN(filepath.Base(path), ".", 2)[0]
+			rec := s.recording(filepath.Join(sub, daemon))
+			upstream := "unix:" + path
+			if err := s.listen(name, func(conn net.Conn) { s.proxy(conn, upstream, rec) }); err != nil {
+				s.logger.Warn("failed proxying control socket", "socket", path, "error", err.Error())
+			}
+		}
+		for name, l := range s.listeners {
+			if strings.HasPrefix(name, sub+string(filepath.Separator)) && !found[name] {
+				l.Close()
+				delete(s.listeners, name)
+			}
+		}
+	}
+}
+
+// listen serves the connections to a socket in the socket directory.
+func (s *debugSockets) listen(name string, serve func(net.Conn)) error {
+	l, err := net.Listen("unix", filepath.Join(s.socketDir, name))
+	if err != nil {
+		return err
+	}
+	s.listeners[name] = l
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if !s.track(conn) {
+				conn.Close()
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.untrack(conn)
+				serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// track registers a connection to be closed by close. It returns false
+// when the sockets are closed already.
+func (s *debugSockets) track(conn net.Conn) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.conns == nil {
+		return false
+	}
+	s.conns[conn] = true
+	return true
+}
+
+func (s *debugSockets) untrack(conn net.Conn) {
+	conn.Close()
+	s.Lock()
+	defer s.Unlock()
+	delete(s.conns, conn)
+}
+
+// close stops the listeners and connections and removes the socket
+// directory. The caller holds the lock.
+func (s *debugSockets) close() {
+	for name, l := range s.listeners {
+		l.Close()
+		delete(s.listeners, name)
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	s.Unlock()
+	s.wg.Wait()
+	s.Lock()
+	os.RemoveAll(s.socketDir)
+}
+
+// proxy forwards the messages between a connection of the exporter and an
+// OVS socket, and records the responses to the requests of the exporter.
+// Requests of OVS, i.e. echo requests of ovsdb-server, are not recorded.
+func (s *debugSockets) proxy(conn net.Conn, upstream string, rec *recording) {
+	network, address := "unix", strings.TrimPrefix(upstream, "unix:")
+	if !strings.HasPrefix(upstream, "unix:") {
+		network, address = "tcp", strings.TrimPrefix(upstream, "tcp:")
+	}
+	server, err := net.Dial(network, address)
+	if err != nil {
+		s.logger.Debug("failed connecting to OVS", "socket", upstream, "error", err.Error())
+		return
+	}
+	if !s.track(server) {
+		server.Close()
+		return
+	}
+	defer s.untrack(server)
+
+	var mu sync.Mutex
+	pending := make(map[string]json.RawMessage)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		dec := json.NewDecoder(conn)
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return
+			}
+			var msg jsonrpcMessage
+			if json.Unmarshal(raw, &msg) == nil && msg.Method != "" {
+				mu.Lock()
+				pending[string(msg.ID)] = raw
+				mu.Unlock()
+			}
+			if _, err := server.Write(raw); err != nil {
+				return
+			}
+		}
+	}()
+
+	dec := json.NewDecoder(server)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			break
+		}
+		var msg jsonrpcMessage
+		if json.Unmarshal(raw, &msg) == nil && msg.Method == "" {
+			mu.Lock()
+			req, exists := pending[string(msg.ID)]
+			delete(pending, string(msg.ID))
+			mu.Unlock()
+			if exists {
+				if err := rec.add(req, raw); err != nil {
+					s.logger.Warn("failed recording OVS response", "file", rec.path, "error", err.Error())
+				}
+			}
+		}
+		if _, err := conn.Write(raw); err != nil {
+			break
+		}
+	}
+	conn.Close()
+	<-done
+}
+
+// serveRecording answers the requests of a connection from a recording.
+func (s *debugSockets) serveRecording(conn net.Conn, rec *recording) {
+	dec := json.NewDecoder(conn)
+	for {
+		var req jsonrpcMessage
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		resp, err := rec.response(req)
+		if err != nil {
+			s.logger.Warn("failed replaying OVS response", "file", rec.path, "method", req.Method, "error", err.Error())
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
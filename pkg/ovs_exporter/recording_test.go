@@ -0,0 +1,90 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []Option{
+		WithTimeout(2),
+		WithLogger(logger),
+		WithDatapathFlows(0),
+		WithHwOffload(0),
+	}
+	dir := t.TempDir()
+
+	fake := newFakeOVS(t, "2.17")
+	recorder := NewExporter(append(opts, WithClientConfig(fake.config()), WithRecordDir(dir))...)
+	if err := recorder.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.SetPollInterval(15)
+	recorder.GatherMetrics()
+	if len(recorder.pollErrors) != 0 {
+		t.Fatalf("unexpected errors while recording: %v", recorder.pollErrors)
+	}
+	// The responses are written at the end of the poll.
+	for _, name := range []string{"system-id.conf", "db.sock.json", "ovs/ovs-vswitchd.json", "ovs/ovsdb-server.json", "ovn/ovn-controller.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be recorded: %s", name, err)
+		}
+	}
+	expected, recorded := goldenText(t, recorder)
+	names := []string{}
+	for _, name := range recorded {
+		// The poll intervals are read from the logs.
+		if !strings.HasPrefix(name, "ovs_poll_interval_") {
+			names = append(names, name)
+		}
+	}
+	recorder.Close()
+	fake.close()
+
+	// Neither /proc nor the logs are recorded, so their collectors are
+	// disabled in replay mode.
+	replayer := NewExporter(append(opts, WithReplayDir(dir), WithProcessResources(), WithVswitchdThreads())...)
+	if err := replayer.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer replayer.Close()
+	replayer.SetPollInterval(15)
+	replayer.GatherMetrics()
+	if len(replayer.pollErrors) != 0 {
+		t.Fatalf("unexpected errors while replaying: %v", replayer.pollErrors)
+	}
+	if replayer.systemRunDir() != fake.dir {
+		t.Errorf("expected the recorded run directory %s, got %s", fake.dir, replayer.systemRunDir())
+	}
+	if err := testutil.CollectAndCompare(replayer, bytes.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ovs_log_file_size", "ovs_poll_interval_seconds", "ovs_process_cpu_seconds_total", "ovs_vswitchd_thread_cpu_seconds_total"} {
+		if n := testutil.CollectAndCount(replayer, name); n != 0 {
+			t.Errorf("expected no %s metrics in replay mode, but got %d", name, n)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Register registers the exporter and the ovs_exporter_build_info metric
+// with r. The build info may already be registered, e.g. by another
+// exporter.
+func (e *Exporter) Register(r prometheus.Registerer) error {
+	if err := r.Register(e); err != nil {
+		return err
+	}
+	if err := r.Register(versioncollector.NewCollector(namespace + "_exporter")); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Server serves the metrics of an exporter from a registry of its own,
+// together with the health and topology endpoints. It implements
+// http.Handler.
+type Server struct {
+	exporter       *Exporter
+	registry       *prometheus.Registry
+	metricsPath    string
+	maxMissedPolls int
+	pprof          bool
+	mux            *http.ServeMux
+}
+
+// ServerOption configures a Server created by NewServer.
+type ServerOption func(*Server)
+
+// WithMetricsPath sets the path of the metrics. It defaults to /metrics.
+func WithMetricsPath(path string) ServerOption {
+	return func(s *Server) {
+		s.metricsPath = path
+	}
+}
+
+// WithReadyzMaxMissedPolls sets the number of poll intervals after which
+// /readyz fails when no poll reached OVSDB. It defaults to 3.
+func WithReadyzMaxMissedPolls(n int) ServerOption {
+	return func(s *Server) {
+		s.maxMissedPolls = n
+	}
+}
+
+// WithRegistry serves the metrics of the given registry, e.g. one shared
+// with other collectors, instead of a new one.
+func WithRegistry(registry *prometheus.Registry) ServerOption {
+	return func(s *Server) {
+		s.registry = registry
+	}
+}
+
+// WithPprof serves the profiles of the Go runtime under /debug/pprof/. They
+// are not served by default, as they expose the internals of the process
+// to anyone reaching the server. See also NewPprofHandler.
+func WithPprof() ServerOption {
+	return func(s *Server) {
+		s.pprof = true
+	}
+}
+
+// NewPprofHandler returns a handler serving the profiles of the Go runtime
+// under /debug/pprof/, e.g. on a listener separate from the metrics.
+func NewPprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// NewServer returns a Server for an exporter. The exporter, its build info
+// and, unless WithRegistry is given, the metrics of the Go runtime and of
+// the process are registered with the registry of the server.
+func NewServer(e *Exporter, options ...ServerOption) (*Server, error) {
+	s := &Server{
+		exporter:       e,
+		metricsPath:    "/metrics",
+		maxMissedPolls: 3,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.registry == nil {
+		s.registry = prometheus.NewRegistry()
+		s.registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+	if err := e.Register(s.registry); err != nil {
+		return nil, err
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.Handle(s.metricsPath, promhttp.InstrumentMetricHandler(
+		s.registry, promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}),
+	))
+	s.mux.Handle("/healthz", e.HealthzHandler())
+	s.mux.Handle("/readyz", e.ReadyzHandler(s.maxMissedPolls))
+	s.mux.Handle("/api/v1/topology", e.TopologyHandler("json"))
+	s.mux.Handle("/api/v1/topology.dot", e.TopologyHandler("dot"))
+	s.mux.Handle("/api/v1/topology.mmd", e.TopologyHandler("mermaid"))
+	if s.pprof {
+		s.mux.Handle("/debug/pprof/", NewPprofHandler())
+	}
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>
+             <head><title>OVS Exporter</title></head>
+             <body>
+             <h1>OVS Exporter</h1>
+             <p><a href='` + s.metricsPath + `'>Metrics</a></p>
+             <p><a href='/api/v1/topology'>Topology</a></p>
+             </body>
+             </html>`))
+	})
+	return s, nil
+}
+
+// Registry returns the registry of the server, e.g. to register further
+// collectors.
+func (s *Server) Registry() *prometheus.Registry {
+	return s.registry
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServers(t *testing.T) {
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each server has a registry of its own, so that exporters can be
+	// embedded more than once.
+	for i := 1; i <= 2; i++ {
+		fake := newFakeOVS(t, "2.17")
+		exporter := NewExporter(WithClientConfig(fake.config()), WithTimeout(2), WithLogger(logger))
+		if err := exporter.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer exporter.Close()
+		exporter.SetPollInterval(15)
+		srv, err := NewServer(exporter, WithMetricsPath("/ovs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(srv)
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "/ovs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{
+			`ovs_up 1`,
+			`ovs_info{`,
+			`ovs_exporter_build_info{`,
+			`go_goroutines `,
+			`promhttp_metric_handler_requests_total{code="200"} 0`,
+		} {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("expected %q in the scrape of server %d", s, i)
+			}
+		}
+
+		res, err = http.Get(server.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected /healthz to respond with 200, but got %d", res.StatusCode)
+		}
+	}
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if strings.HasPrefix(mf.GetName(), "ovs_") {
+			t.Errorf("expected no metrics in the default registry, but got %s", mf.GetName())
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := NewExporter().Register(registry); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	// The second exporter has the same metrics as the first one.
+	if err := NewExporter().Register(registry); err == nil {
+		t.Fatalf("expected the second exporter to be rejected")
+	}
+	if err := NewExporter().Register(prometheus.NewRegistry()); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+}
+
+func TestServerPprof(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		options := []ServerOption{}
+		if enabled {
+			options = append(options, WithPprof())
+		}
+		srv, err := NewServer(NewExporter(), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := httptest.NewServer(srv)
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "/debug/pprof/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if served := strings.Contains(string(body), "Types of profiles available"); served != enabled {
+			t.Errorf("expected pprof to be served: %t, but got %t", enabled, served)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WriteTextfile runs a single poll and writes the metrics of the exporter in
+// the text exposition format to path, e.g. a file in the textfile collector
+// directory of node_exporter. The file is replaced atomically.
+//
+// The metrics of the Go runtime and of the exporter process are left out,
+// because they would clash with the ones of node_exporter.
+func (e *Exporter) WriteTextfile(path string) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(e); err != nil {
+		return err
+	}
+	return writeTextfile(path, registry)
+}
+
+func writeTextfile(path string, g prometheus.Gatherer) error {
+	return prometheus.WriteToTextfile(path, g)
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ovs.prom")
+	if err := os.WriteFile(path, []byte("stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ovs_up", Help: "Is OVS stack up (1) or is it down (0)."})
+	gauge.Set(1)
+	registry.MustRegister(gauge)
+	if err := writeTextfile(path, registry); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# HELP ovs_up Is OVS stack up (1) or is it down (0).\n# TYPE ovs_up gauge\novs_up 1\n"
+	if string(b) != expected {
+		t.Fatalf("expected %q, but got %q", expected, b)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Fatalf("expected mode 0644, but got %v", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected no temporary files to be left, but got %v", entries)
+	}
+}
+
+func TestWriteTextfileCollect(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	// The messages logged before the collect command runs are counted.
+	fake.writeFile("ovs-vswitchd.log",
+		"2024-01-01T00:00:00.000Z|00001|bridge|INFO|ovs-vswitchd (Open vSwitch) 2.17.9\n"+
+			"2024-01-01T00:00:01.000Z|00002|netdev_linux|WARN|tap9: removing policing failed: No such device\n")
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+	exporter.SetPollInterval(15)
+
+	path := filepath.Join(t.TempDir(), "ovs.prom")
+	if err := exporter.WriteTextfile(path); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(b)
+	expected := []string{
+		"ovs_up 1",
+		`ovs_dp_lookups_hit{datapath="system@ovs-system",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 182317`,
+		`ovs_log_events_total{component="ovs-vswitchd",severity="info",source="bridge",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1`,
+		`ovs_log_events_total{component="ovs-vswitchd",severity="warn",source="netdev_linux",system_id="4c2ba5b5-7a1d-4b1e-8a2e-0d9e5e0c1b01"} 1`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(text, s) {
+			t.Errorf("expected %q in the textfile", s)
+		}
+	}
+	for _, prefix := range []string{"go_", "process_"} {
+		if strings.Contains(text, "\n"+prefix) {
+			t.Errorf("expected no %s metrics in the textfile", prefix)
+		}
+	}
+}
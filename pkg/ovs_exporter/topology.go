@@ -0,0 +1,216 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"io"
+	"net/http"
+	"sort"
+)
+
+// Topology is the bridge, port and interface tree of an OVS host, similar
+// to the output of `ovs-vsctl show`.
+type Topology struct {
+	SystemID string            `json:"system_id"`
+	Hostname string            `json:"hostname"`
+	Version  string            `json:"ovs_version"`
+	Bridges  []*TopologyBridge `json:"bridges"`
+}
+
+// TopologyBridge is a bridge of the Bridge table.
+type TopologyBridge struct {
+	UUID         string            `json:"uuid"`
+	Name         string            `json:"name"`
+	Datapath     string            `json:"datapath,omitempty"`
+	DatapathType string            `json:"datapath_type"`
+	FailMode     string            `json:"fail_mode,omitempty"`
+	ExternalIDs  map[string]string `json:"external_ids"`
+	Ports        []*TopologyPort   `json:"ports"`
+}
+
+// TopologyPort is a port of the Port table.
+type TopologyPort struct {
+	UUID        string               `json:"uuid"`
+	Name        string               `json:"name"`
+	Tag         *int64               `json:"tag,omitempty"`
+	Trunks      []int64              `json:"trunks,omitempty"`
+	VlanMode    string               `json:"vlan_mode,omitempty"`
+	ExternalIDs map[string]string    `json:"external_ids"`
+	Interfaces  []*TopologyInterface `json:"interfaces"`
+}
+
+// TopologyInterface is an interface of the Interface table.
+type TopologyInterface struct {
+	UUID         string            `json:"uuid"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	OfPort       int64             `json:"ofport"`
+	DatapathPort *int64            `json:"datapath_port,omitempty"`
+	AdminState   string            `json:"admin_state,omitempty"`
+	LinkState    string            `json:"link_state,omitempty"`
+	LinkSpeed    int64             `json:"link_speed,omitempty"`
+	MTU          int64             `json:"mtu,omitempty"`
+	MAC          string            `json:"mac_in_use,omitempty"`
+	Options      map[string]string `json:"options"`
+	ExternalIDs  map[string]string `json:"external_ids"`
+	Statistics   map[string]int    `json:"statistics"`
+}
+
+// buildTopology joins the bridges and ports of the Bridge and Port tables
+// with the interfaces of the Interface table and the datapath ports of
+// `ovs-appctl dpif/show`.
+func buildTopology(bridges []*Bridge, ports []*Port, intfs []*Interface, dpIntfs []*Interface) []*TopologyBridge {
+	intfsByUUID := make(map[string]*Interface, len(intfs))
+	for _, intf := range intfs {
+		intfsByUUID[intf.UUID] = intf
+	}
+	dpIntfsByName := make(map[string]*Interface, len(dpIntfs))
+	for _, intf := range dpIntfs {
+		dpIntfsByName[intf.Name] = intf
+	}
+
+	portsByUUID := make(map[string]*TopologyPort, len(ports))
+	for _, p := range ports {
+		port := &TopologyPort{
+			UUID:        p.UUID,
+			Name:        p.Name,
+			Tag:         p.Tag,
+			Trunks:      p.Trunks,
+			VlanMode:    p.VlanMode,
+			ExternalIDs: p.ExternalIDs,
+			Interfaces:  []*TopologyInterface{},
+		}
+		for _, id := range p.Interfaces {
+			intf, exists := intfsByUUID[id]
+			if !exists {
+				continue
+			}
+			ti := &TopologyInterface{
+				UUID:        intf.UUID,
+				Name:        intf.Name,
+				Type:        intf.Type,
+				OfPort:      int64(intf.OfPort),
+				AdminState:  intf.AdminState,
+				LinkState:   intf.LinkState,
+				LinkSpeed:   int64(intf.LinkSpeed),
+				MTU:         int64(intf.Mtu),
+				MAC:         intf.MacInUse,
+				Options:     intf.Options,
+				ExternalIDs: intf.ExternalIDs,
+				Statistics:  intf.Statistics,
+			}
+			if ti.Type == "" {
+				ti.Type = "system"
+			}
+			if dpIntf, exists := dpIntfsByName[intf.Name]; exists {
+				index := int64(dpIntf.Index)
+				ti.DatapathPort = &index
+			}
+			port.Interfaces = append(port.Interfaces, ti)
+		}
+		sort.Slice(port.Interfaces, func(i, j int) bool { return port.Interfaces[i].Name < port.Interfaces[j].Name })
+		portsByUUID[port.UUID] = port
+	}
+
+	topology := []*TopologyBridge{}
+	for _, b := range bridges {
+		br := &TopologyBridge{
+			UUID:         b.UUID,
+			Name:         b.Name,
+			DatapathType: b.DatapathType,
+			FailMode:     b.FailMode,
+			ExternalIDs:  b.ExternalIDs,
+			Ports:        []*TopologyPort{},
+		}
+		if br.DatapathType == "" {
+			br.DatapathType = "system"
+		}
+		for _, id := range b.Ports {
+			if port, exists := portsByUUID[id]; exists {
+				br.Ports = append(br.Ports, port)
+			}
+		}
+		sort.Slice(br.Ports, func(i, j int) bool { return br.Ports[i].Name < br.Ports[j].Name })
+		for _, intf := range dpIntfs {
+			if intf.BridgeName == br.Name {
+				br.Datapath = intf.DatapathName
+				break
+			}
+		}
+		topology = append(topology, br)
+	}
+	sort.Slice(topology, func(i, j int) bool { return topology[i].Name < topology[j].Name })
+	return topology
+}
+
+// GetTopology queries OVS for the bridge, port and interface tree. The
+// exporter is only locked to copy the client and the system information,
+// so that the queries do not block polls and scrapes.
+func (e *Exporter) GetTopology() (*Topology, error) {
+	e.RLock()
+	client := e.client
+	system := e.system
+	e.RUnlock()
+	bridges, err := client.GetDbBridges()
+	if err != nil {
+		return nil, err
+	}
+	ports, err := client.GetDbPorts()
+	if err != nil {
+		return nil, err
+	}
+	intfs, err := client.GetDbInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	// The datapath ports are optional, e.g. when ovs-vswitchd is down.
+	_, _, dpIntfs, err := client.GetAppDatapath("vswitchd-service")
+	if err != nil {
+		e.logger.Debug("GetTopology() skips datapath ports", "error", err.Error())
+		dpIntfs = nil
+	}
+	return &Topology{
+		SystemID: system.ID,
+		Hostname: system.Hostname,
+		Version:  system.OvsVersion,
+		Bridges:  buildTopology(bridges, ports, intfs, dpIntfs),
+	}, nil
+}
+
+var topologyContentTypes = map[string]string{
+	"json":    "application/json",
+	"dot":     "text/vnd.graphviz; charset=utf-8",
+	"mermaid": "text/plain; charset=utf-8",
+}
+
+// TopologyHandler returns a handler serving the topology in one of the
+// TopologyFormats. It queries OVS on each request.
+func (e *Exporter) TopologyHandler(format string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topology, err := e.GetTopology()
+		if err != nil {
+			e.logger.Error("GetTopology() failed", "error", err.Error())
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		body, err := RenderTopology(topology, format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", topologyContentTypes[format])
+		io.WriteString(w, body)
+	})
+}
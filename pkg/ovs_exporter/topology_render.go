@@ -0,0 +1,285 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TopologyFormats are the formats supported by RenderTopology.
+var TopologyFormats = []string{"json", "dot", "mermaid"}
+
+// tunnelTypes are the interface types of tunnel ports.
+var tunnelTypes = map[string]bool{
+	"geneve":    true,
+	"vxlan":     true,
+	"gre":       true,
+	"ip6gre":    true,
+	"erspan":    true,
+	"ip6erspan": true,
+	"stt":       true,
+	"lisp":      true,
+	"gtpu":      true,
+	"bareudp":   true,
+	"srv6":      true,
+}
+
+// uplinkTypes are the interface types of ports that may be physical
+// uplinks.
+var uplinkTypes = map[string]bool{
+	"system": true,
+	"dpdk":   true,
+	"afxdp":  true,
+}
+
+// graphNode is a bridge, a physical uplink or a tunnel endpoint.
+type graphNode struct {
+	id    string
+	label string
+	kind  string
+}
+
+// graphEdge links a bridge to another bridge, an uplink or a tunnel
+// endpoint.
+type graphEdge struct {
+	from  string
+	to    string
+	label string
+	kind  string
+}
+
+// topologyGraph is the graph of bridges and their links to each other and
+// to the outside of the host.
+type topologyGraph struct {
+	nodes []graphNode
+	edges []graphEdge
+}
+
+// isUplink returns true when a port is a physical uplink or a bond of
+// physical uplinks. VM ports are told apart by the iface-id external ID set
+// by OVN and other cloud management systems.
+func isUplink(port *TopologyPort) bool {
+	if len(port.Interfaces) == 0 {
+		return false
+	}
+	for _, intf := range port.Interfaces {
+		if !uplinkTypes[intf.Type] {
+			return false
+		}
+		if _, exists := intf.ExternalIDs["iface-id"]; exists {
+			return false
+		}
+		if _, exists := intf.ExternalIDs["attached-mac"]; exists {
+			return false
+		}
+	}
+	return true
+}
+
+// newTopologyGraph builds the graph of a topology. Patch ports become links
+// between bridges, tunnel ports links to their remote_ip, and physical
+// uplinks links to nodes of their own. Other ports, e.g. of VMs, are only
+// counted in the label of their bridge.
+func newTopologyGraph(bridges []*TopologyBridge) topologyGraph {
+	g := topologyGraph{}
+	ids := make(map[string]string)
+	node := func(key, label, kind string) string {
+		if id, exists := ids[key]; exists {
+			return id
+		}
+		id := "n" + strconv.Itoa(len(ids))
+		ids[key] = id
+		g.nodes = append(g.nodes, graphNode{id: id, label: label, kind: kind})
+		return id
+	}
+
+	// The bridge of each patch interface, to find the peer bridge.
+	patchBridges := make(map[string]string)
+	for _, br := range bridges {
+		for _, port := range br.Ports {
+			for _, intf := range port.Interfaces {
+				if intf.Type == "patch" {
+					patchBridges[intf.Name] = br.Name
+				}
+			}
+		}
+	}
+
+	for _, br := range bridges {
+		others := 0
+		for _, port := range br.Ports {
+			if port.Name == br.Name {
+				continue
+			}
+			switch {
+			case len(port.Interfaces) == 1 && port.Interfaces[0].Type == "patch":
+			case len(port.Interfaces) == 1 && (tunnelTypes[port.Interfaces[0].Type] || port.Interfaces[0].Options["remote_ip"] != ""):
+			case isUplink(port):
+			default:
+				others++
+			}
+		}
+		label := fmt.Sprintf("%s\n%s", br.Name, br.DatapathType)
+		if others > 0 {
+			label = fmt.Sprintf("%s, other ports: %d", label, others)
+		}
+		node("bridge:"+br.Name, label, "bridge")
+	}
+
+	patches := make(map[string]bool)
+	for _, br := range bridges {
+		from := ids["bridge:"+br.Name]
+		for _, port := range br.Ports {
+			if port.Name == br.Name {
+				continue
+			}
+			if len(port.Interfaces) == 1 {
+				intf := port.Interfaces[0]
+				if intf.Type == "patch" {
+					peer := intf.Options["peer"]
+					peerBridge, exists := patchBridges[peer]
+					if !exists {
+						continue
+					}
+					pair := []string{intf.Name, peer}
+					sort.Strings(pair)
+					if patches[pair[0]+"\x00"+pair[1]] {
+						continue
+					}
+					patches[pair[0]+"\x00"+pair[1]] = true
+					g.edges = append(g.edges, graphEdge{
+						from:  from,
+						to:    ids["bridge:"+peerBridge],
+						label: intf.Name + " / " + peer,
+						kind:  "patch",
+					})
+					continue
+				}
+				if remoteIP := intf.Options["remote_ip"]; tunnelTypes[intf.Type] || remoteIP != "" {
+					if remoteIP == "" {
+						remoteIP = "unknown"
+					}
+					to := node("tunnel:"+remoteIP, "remote_ip "+remoteIP, "tunnel")
+					g.edges = append(g.edges, graphEdge{
+						from:  from,
+						to:    to,
+						label: intf.Type + " " + intf.Name,
+						kind:  "tunnel",
+					})
+					continue
+				}
+			}
+			if isUplink(port) {
+				names := []string{}
+				for _, intf := range port.Interfaces {
+					names = append(names, intf.Name)
+				}
+				label := port.Name
+				if len(names) > 1 || names[0] != port.Name {
+					label = fmt.Sprintf("%s (%s)", port.Name, strings.Join(names, ", "))
+				}
+				to := node("uplink:"+br.Name+":"+port.Name, label, "uplink")
+				g.edges = append(g.edges, graphEdge{
+					from:  from,
+					to:    to,
+					label: port.Interfaces[0].Type,
+					kind:  "uplink",
+				})
+			}
+		}
+	}
+	return g
+}
+
+var dotShapes = map[string]string{
+	"bridge": "box",
+	"uplink": "ellipse",
+	"tunnel": "diamond",
+}
+
+var dotStyles = map[string]string{
+	"patch":  "solid",
+	"tunnel": "dashed",
+	"uplink": "bold",
+}
+
+// dot renders the graph in the Graphviz DOT language.
+func (g topologyGraph) dot(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph %s {\n", strconv.Quote(name))
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", n.id, strconv.Quote(n.label), dotShapes[n.kind])
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "  %s -- %s [label=%s, style=%s];\n", e.from, e.to, strconv.Quote(e.label), dotStyles[e.kind])
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// mermaidText escapes a label for a Mermaid flowchart.
+func mermaidText(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+var mermaidShapes = map[string][2]string{
+	"bridge": {"[", "]"},
+	"uplink": {"([", "])"},
+	"tunnel": {"{", "}"},
+}
+
+var mermaidLinks = map[string]string{
+	"patch":  "---",
+	"tunnel": "-.-",
+	"uplink": "===",
+}
+
+// mermaid renders the graph as a Mermaid flowchart.
+func (g topologyGraph) mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.nodes {
+		shape := mermaidShapes[n.kind]
+		fmt.Fprintf(&b, "  %s%s\"%s\"%s\n", n.id, shape[0], mermaidText(n.label), shape[1])
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "  %s %s|\"%s\"| %s\n", e.from, mermaidLinks[e.kind], mermaidText(e.label), e.to)
+	}
+	return b.String()
+}
+
+// RenderTopology renders a topology as JSON, as a Graphviz DOT graph or as
+// a Mermaid flowchart.
+func RenderTopology(topology *Topology, format string) (string, error) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(topology, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	case "dot":
+		return newTopologyGraph(topology.Bridges).dot(topology.Hostname), nil
+	case "mermaid":
+		return newTopologyGraph(topology.Bridges).mermaid(), nil
+	}
+	return "", fmt.Errorf("unsupported topology format %s", format)
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"testing"
+)
+
+func renderTestTopology() *Topology {
+	port := func(name string, intfs ...*TopologyInterface) *TopologyPort {
+		return &TopologyPort{Name: name, Interfaces: intfs}
+	}
+	intf := func(name, typ string, options map[string]string, externalIDs map[string]string) *TopologyInterface {
+		return &TopologyInterface{Name: name, Type: typ, Options: options, ExternalIDs: externalIDs}
+	}
+	return &Topology{
+		Hostname: "hv1",
+		Bridges: []*TopologyBridge{
+			{
+				Name:         "br-ex",
+				DatapathType: "system",
+				Ports: []*TopologyPort{
+					port("br-ex", intf("br-ex", "internal", nil, nil)),
+					port("bond0", intf("eth1", "system", nil, nil), intf("eth2", "system", nil, nil)),
+					port("patch-ex-to-int", intf("patch-ex-to-int", "patch", map[string]string{"peer": "patch-int-to-ex"}, nil)),
+				},
+			},
+			{
+				Name:         "br-int",
+				DatapathType: "system",
+				Ports: []*TopologyPort{
+					port("br-int", intf("br-int", "internal", nil, nil)),
+					port("ovn-hv2-0", intf("ovn-hv2-0", "geneve", map[string]string{"remote_ip": "10.0.0.2"}, nil)),
+					port("patch-int-to-ex", intf("patch-int-to-ex", "patch", map[string]string{"peer": "patch-ex-to-int"}, nil)),
+					port("tap0", intf("tap0", "system", nil, map[string]string{"iface-id": "vm1"})),
+				},
+			},
+		},
+	}
+}
+
+func TestRenderTopologyDot(t *testing.T) {
+	output, err := RenderTopology(renderTestTopology(), "dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `graph "hv1" {
+  rankdir=LR;
+  n0 [label="br-ex\nsystem", shape=box];
+  n1 [label="br-int\nsystem, other ports: 1", shape=box];
+  n2 [label="bond0 (eth1, eth2)", shape=ellipse];
+  n3 [label="remote_ip 10.0.0.2", shape=diamond];
+  n0 -- n2 [label="system", style=bold];
+  n0 -- n1 [label="patch-ex-to-int / patch-int-to-ex", style=solid];
+  n1 -- n3 [label="geneve ovn-hv2-0", style=dashed];
+}
+`
+	if output != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, output)
+	}
+}
+
+func TestRenderTopologyMermaid(t *testing.T) {
+	output, err := RenderTopology(renderTestTopology(), "mermaid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `flowchart LR
+  n0["br-ex<br>system"]
+  n1["br-int<br>system, other ports: 1"]
+  n2(["bond0 (eth1, eth2)"])
+  n3{"remote_ip 10.0.0.2"}
+  n0 ===|"system"| n2
+  n0 ---|"patch-ex-to-int / patch-int-to-ex"| n1
+  n1 -.-|"geneve ovn-hv2-0"| n3
+`
+	if output != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, output)
+	}
+	if _, err := RenderTopology(renderTestTopology(), "svg"); err == nil {
+		t.Fatalf("expected an unsupported format to be rejected")
+	}
+}
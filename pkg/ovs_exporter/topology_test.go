@@ -0,0 +1,158 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testTopology returns br-int with a VLAN tagged VM port and a patch port
+// to br-ex, and br-ex with the peer patch port and a physical uplink.
+func testTopology(t *testing.T) []*TopologyBridge {
+	t.Helper()
+	tag := int64(100)
+	bridges := []*Bridge{
+		{UUID: "b1", Name: "br-int", Ports: []string{"p1", "p2"}, FailMode: "secure", ExternalIDs: map[string]string{}},
+		{UUID: "b2", Name: "br-ex", Ports: []string{"p3"}, DatapathType: "system", ExternalIDs: map[string]string{"bridge-id": "br-ex"}},
+	}
+	ports := []*Port{
+		{UUID: "p1", Name: "tap0", Interfaces: []string{"i1"}, Tag: &tag, ExternalIDs: map[string]string{}},
+		{UUID: "p2", Name: "patch-int-to-ex", Interfaces: []string{"i2"}, Trunks: []int64{10, 20}, VlanMode: "trunk", ExternalIDs: map[string]string{}},
+		{UUID: "p3", Name: "eth1", Interfaces: []string{"i3", "i4"}, ExternalIDs: map[string]string{}},
+	}
+	intfs := []*Interface{
+		{UUID: "i1", Name: "tap0", OfPort: 1, LinkState: "up", Statistics: map[string]int{"rx_packets": 5}},
+		{UUID: "i2", Name: "patch-int-to-ex", Type: "patch", OfPort: 2, Options: map[string]string{"peer": "patch-ex-to-int"}},
+		{UUID: "i3", Name: "eth1", OfPort: 1, LinkState: "up"},
+	}
+	dpIntfs := []*Interface{
+		{Name: "tap0", Index: 3, BridgeName: "br-int", DatapathName: "system@ovs-system"},
+		{Name: "eth1", Index: 4, BridgeName: "br-ex", DatapathName: "system@ovs-system"},
+	}
+	return buildTopology(bridges, ports, intfs, dpIntfs)
+}
+
+func TestBuildTopology(t *testing.T) {
+	topology := testTopology(t)
+	if len(topology) != 2 || topology[0].Name != "br-ex" || topology[1].Name != "br-int" {
+		t.Fatalf("expected bridges br-ex and br-int, but got %+v", topology)
+	}
+
+	brEx := topology[0]
+	if brEx.Datapath != "system@ovs-system" || brEx.FailMode != "" || brEx.ExternalIDs["bridge-id"] != "br-ex" {
+		t.Fatalf("unexpected bridge: %+v", brEx)
+	}
+	if len(brEx.Ports) != 1 || len(brEx.Ports[0].Interfaces) != 1 {
+		t.Fatalf("expected eth1 with one known interface, but got %+v", brEx.Ports)
+	}
+	if dpPort := brEx.Ports[0].Interfaces[0].DatapathPort; dpPort == nil || *dpPort != 4 {
+		t.Fatalf("expected datapath port 4, but got %v", dpPort)
+	}
+
+	brInt := topology[1]
+	if brInt.DatapathType != "system" || brInt.FailMode != "secure" || len(brInt.Ports) != 2 {
+		t.Fatalf("unexpected bridge: %+v", brInt)
+	}
+	patch, tap := brInt.Ports[0], brInt.Ports[1]
+	if patch.Tag != nil || !reflect.DeepEqual(patch.Trunks, []int64{10, 20}) || patch.VlanMode != "trunk" {
+		t.Fatalf("unexpected patch port: %+v", patch)
+	}
+	if patch.Interfaces[0].Type != "patch" || patch.Interfaces[0].Options["peer"] != "patch-ex-to-int" {
+		t.Fatalf("unexpected patch interface: %+v", patch.Interfaces[0])
+	}
+	if tap.Tag == nil || *tap.Tag != 100 || len(tap.Trunks) != 0 {
+		t.Fatalf("unexpected VM port: %+v", tap)
+	}
+	if intf := tap.Interfaces[0]; intf.Type != "system" || intf.LinkState != "up" || intf.Statistics["rx_packets"] != 5 {
+		t.Fatalf("unexpected VM interface: %+v", intf)
+	}
+
+	b, err := json.Marshal(brInt.Ports[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["tag"] != float64(100) {
+		t.Fatalf("expected tag 100 in %s", b)
+	}
+}
+
+func TestGetTopology(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+	)
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	topology, err := exporter.GetTopology()
+	if err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	if topology.Version != "2.17.9" || topology.Hostname != "hv1" {
+		t.Fatalf("unexpected topology: %+v", topology)
+	}
+	if len(topology.Bridges) == 0 || topology.Bridges[0].Name != "br-ex" {
+		t.Fatalf("unexpected bridges: %+v", topology.Bridges)
+	}
+}
+
+// TestGetTopologyDuringPoll queries the topology while the exporter polls,
+// both through the same client. Run it with -race.
+func TestGetTopologyDuringPoll(t *testing.T) {
+	fake := newFakeOVS(t, "2.17")
+	logger, err := NewLogger("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithClientConfig(fake.config()),
+		WithTimeout(2),
+		WithLogger(logger),
+		WithDatapathFlows(0),
+	)
+	exporter.SetPollInterval(0)
+	if err := exporter.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			exporter.GatherMetrics()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := exporter.GetTopology(); err != nil {
+			t.Errorf("expected no error, but got %q", err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+var (
+	// OVS vswitchd Threads
+	vswitchdThreadCPUSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vswitchd", "thread_cpu_seconds_total"),
+		"The CPU time spent by a thread of ovs-vswitchd in user and system mode. The values of thread_class are: main, handler, revalidator, pmd, urcu, monitor, other.",
+		[]string{"system_id", "thread_class", "thread"}, nil,
+	)
+	vswitchdThreads = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "vswitchd", "threads"),
+		"The number of threads of ovs-vswitchd by thread class.",
+		[]string{"system_id", "thread_class"}, nil,
+	)
+)
+
+// vswitchdThreadClasses are the classes of ovs-vswitchd threads by the
+// prefix of their names. Threads matching none of them are "other", except
+// for the main thread.
+var vswitchdThreadClasses = []struct {
+	prefix string
+	class  string
+}{
+	{"handler", "handler"},
+	{"revalidator", "revalidator"},
+	{"pmd", "pmd"},
+	{"urcu", "urcu"},
+	{"monitor", "monitor"},
+}
+
+// classifyVswitchdThread returns the class of an ovs-vswitchd thread by its
+// name, e.g. "handler12", "revalidator3" or "pmd-c03/id:7".
+func classifyVswitchdThread(name string) string {
+	if name == "ovs-vswitchd" {
+		return "main"
+	}
+	for _, c := range vswitchdThreadClasses {
+		if strings.HasPrefix(name, c.prefix) {
+			return c.class
+		}
+	}
+	return "other"
+}
+
+// gatherVswitchdThreads collects the CPU time of ovs-vswitchd threads from
+// /proc/<pid>/task/<tid>. Threads with the same name are summed up.
+func (e *Exporter) gatherVswitchdThreads(pid int) error {
+	fs, err := procfs.NewFS(e.procPath)
+	if err != nil {
+		return err
+	}
+	threads, err := fs.AllThreads(pid)
+	if err != nil {
+		return fmt.Errorf("failed reading threads of pid %d: %s", pid, err)
+	}
+
+	cpu := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, c := range vswitchdThreadClasses {
+		counts[c.class] = 0
+	}
+	counts["main"] = 0
+	counts["other"] = 0
+	for _, thread := range threads {
+		name, err := thread.Comm()
+		if err != nil {
+			// The thread exited in the meantime.
+			continue
+		}
+		stat, err := thread.Stat()
+		if err != nil {
+			continue
+		}
+		cpu[name] += stat.CPUTime()
+		counts[classifyVswitchdThread(name)]++
+	}
+
+	for name, value := range cpu {
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			vswitchdThreadCPUSeconds,
+			prometheus.CounterValue,
+			value,
+			e.system.ID,
+			classifyVswitchdThread(name),
+			name,
+		))
+	}
+	for class, count := range counts {
+		e.metrics = append(e.metrics, prometheus.MustNewConstMetric(
+			vswitchdThreads,
+			prometheus.GaugeValue,
+			float64(count),
+			e.system.ID,
+			class,
+		))
+	}
+	return nil
+}
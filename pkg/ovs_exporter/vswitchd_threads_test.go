@@ -0,0 +1,58 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs_exporter
+
+import (
+	"os"
+	"testing"
+)
+
+func TestClassifyVswitchdThread(t *testing.T) {
+	testcases := map[string]string{
+		"ovs-vswitchd":  "main",
+		"handler12":     "handler",
+		"revalidator3":  "revalidator",
+		"pmd-c03/id:7":  "pmd",
+		"urcu2":         "urcu",
+		"monitor":       "monitor",
+		"dpdk_watchdog": "other",
+	}
+	for name, expected := range testcases {
+		if class := classifyVswitchdThread(name); class != expected {
+			t.Errorf("thread %s: expected class %s, but got %s", name, expected, class)
+		}
+	}
+}
+
+func TestGatherVswitchdThreads(t *testing.T) {
+	if _, err := os.Stat("/proc/self/task"); err != nil {
+		t.Skip("procfs is not available")
+	}
+	logger, err := NewLogger("info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter(
+		WithTimeout(2),
+		WithLogger(logger),
+	)
+	if err := exporter.gatherVswitchdThreads(os.Getpid()); err != nil {
+		t.Fatalf("expected no error, but got %q", err)
+	}
+	// At least one thread and a thread count for each of the 7 classes.
+	if len(exporter.metrics) < 8 {
+		t.Fatalf("expected at least 8 metrics, but got %d", len(exporter.metrics))
+	}
+}